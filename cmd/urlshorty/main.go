@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
+	"os"
 
 	"urlshorty/internal/app"
 	"urlshorty/internal/config"
@@ -11,14 +13,39 @@ import (
 func main() {
 	cfg := config.FromEnv()
 
+	// Subcommands: "urlshorty migrate ..." manages the schema and exits.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), cfg, os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	// Route the standard log package through the structured logger too.
+	slog.SetDefault(app.NewLogger(cfg, os.Stderr))
+
 	a, err := app.New(context.Background(), cfg)
 	if err != nil {
 		log.Fatalf("boot: %v", err)
 	}
-	log.Printf("urlshorty listening on %s (BASE_URL=%s, DB=%s)", a.Addr(), cfg.BaseURL, cfg.DBPath)
+	db := cfg.DBPath
+	switch cfg.DBDriver {
+	case config.DriverPostgres:
+		db = "postgres"
+	case config.DriverMemory:
+		db = "memory"
+		if cfg.MemorySnapshot != "" {
+			db += " (snapshot " + cfg.MemorySnapshot + ")"
+		}
+	}
+	log.Printf("urlshorty listening on %s (BASE_URL=%s, DB=%s)", a.Addr(), cfg.BaseURL, db)
+	if a.MetricsServer != nil {
+		log.Printf("metrics listening on %s", a.MetricsServer.Addr)
+	}
 
-	// Blocking; press Ctrl+C to stop the process.
+	// Blocking; SIGINT/SIGTERM drains in-flight requests and closes the store.
 	if err := a.Start(); err != nil {
 		log.Fatalf("server: %v", err)
 	}
+	log.Printf("urlshorty stopped")
 }
@@ -2,7 +2,18 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"html/template"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -10,30 +21,111 @@ import (
 	"urlshorty/internal/core"
 	httpapi "urlshorty/internal/http"
 	"urlshorty/internal/id"
+	"urlshorty/internal/metrics"
 	"urlshorty/internal/rate"
-	"urlshorty/internal/store/sqlite"
+	"urlshorty/internal/threat"
 )
 
+const defaultShutdownTimeout = 15 * time.Second
+
 // App wires config, storage, core service, rate limiters, and the HTTP router.
 type App struct {
-	Cfg     config.Config
-	Store   *sqlite.Store
-	Service *core.Service
-	Limiter *rate.Limiter
-	Router  *gin.Engine
+	Cfg      config.Config
+	Store    Store
+	Service  *core.Service
+	Recorder *core.Recorder
+	Limiter  *rate.Limiter
+	Router   *gin.Engine
+	Server   *http.Server
+	Logger   *slog.Logger
+	Metrics  *metrics.Registry // nil when metrics are disabled
+	// MetricsServer serves /metrics on Cfg.MetricsAddr; nil when metrics
+	// share the main listener (or are disabled).
+	MetricsServer *http.Server
+	Threats       *threat.List // nil when no threat list is configured
+
+	janitor   *janitor
+	watcher   *threatWatcher
+	closeOnce sync.Once
+	closeErr  error
 }
 
 // New builds a fully-wired application instance.
 func New(ctx context.Context, cfg config.Config) (*App, error) {
-	// Open SQLite store (creates DB file and applies schema if missing).
-	store, err := sqlite.Open(cfg.DBPath)
+	// Destination policy and page templates are read before anything is opened.
+	policy, err := newURLPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var scheduledPage *template.Template
+	if cfg.ScheduledPageFile != "" {
+		if scheduledPage, err = template.ParseFiles(cfg.ScheduledPageFile); err != nil {
+			return nil, fmt.Errorf("scheduled page: %w", err)
+		}
+	}
+	var threats *threat.List
+	var matcher core.ThreatMatcher
+	if cfg.ThreatListFile != "" {
+		if threats, err = threat.Open(cfg.ThreatListFile); err != nil {
+			return nil, err
+		}
+		matcher = threats
+	}
+
+	// Open the configured store (applies pending migrations).
+	store, err := openStore(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("open sqlite: %w", err)
+		return nil, err
 	}
 
+	var reg *metrics.Registry
+	if cfg.MetricsEnabled {
+		reg = metrics.NewRegistry()
+		driver := cfg.DBDriver
+		if driver == "" {
+			driver = config.DriverSQLite
+		}
+		store = instrumentStore(store, driver, reg.Histogram("urlshorty_store_query_duration_seconds",
+			"Store call latency by driver and operation.", nil, "driver", "op"))
+	}
+
+	// Batched click recorder: redirects enqueue, one goroutine writes.
+	rec := core.NewRecorder(store, core.RecorderOptions{
+		QueueSize:     cfg.HitQueueSize,
+		BatchSize:     cfg.HitBatchSize,
+		FlushInterval: cfg.HitFlushInterval,
+
+		EnqueueTimeout: cfg.HitEnqueueTimeout,
+	})
+
+	// Redirect cache (disabled when CacheSize <= 0).
+	cache := core.NewCache(core.CacheOptions{
+		Size:        cfg.CacheSize,
+		TTL:         cfg.CacheTTL,
+		NegativeTTL: cfg.CacheNegativeTTL,
+	})
+
 	// ID generator and core service.
 	gen := id.NewGenerator(cfg.CodeLength)
-	svc := core.NewService(store, gen)
+	svc := core.NewService(store, gen, core.Options{
+		IPHashSalt:   cfg.IPHashSalt,
+		Recorder:     rec,
+		PurgeGrace:   cfg.PurgeGrace,
+		PurgeArchive: cfg.PurgeMode == config.PurgeArchive,
+		Keys:         store,
+		AdminKey:     cfg.AdminAPIKey,
+		RequireAuth:  cfg.RequireAuth,
+		Cache:        cache,
+		Dedupe:       cfg.Dedupe,
+		MaxTTL:       cfg.MaxTTL,
+		AnonymousTTL: cfg.AnonymousDefaultTTL,
+		Normalize: core.NormalizeOptions{
+			StripParams: cfg.StripQueryParams,
+			SortQuery:   cfg.SortQueryParams,
+		},
+		Policy:  policy,
+		Threats: matcher,
+	})
 
 	// In-memory rate limiter for POST /api/shorten
 	var limiter *rate.Limiter
@@ -41,18 +133,83 @@ func New(ctx context.Context, cfg config.Config) (*App, error) {
 		limiter = rate.NewLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)
 	}
 
-	// HTTP router
-	router := httpapi.NewRouter(svc, httpapi.Options{
-		BaseURL:     cfg.BaseURL,
-		RateLimiter: limiter,
-	})
+	// Password attempts on protected links, per code and client IP.
+	var unlockLimiter *rate.Limiter
+	if cfg.UnlockAttempts > 0 {
+		unlockLimiter = rate.NewLimiterEvery(cfg.UnlockAttemptInterval, cfg.UnlockAttempts)
+	}
+
+	// HTTP router (plus metrics, on the main or a separate listener)
+	logger := NewLogger(cfg, os.Stderr)
+	routerOpts := httpapi.Options{
+		BaseURL:      cfg.BaseURL,
+		RateLimiter:  limiter,
+		BulkMaxItems: cfg.BulkMaxItems,
+		Logger:       logger,
+
+		RedirectStatus: cfg.RedirectStatus,
+
+		UnlockSecret:  cfg.UnlockSecret,
+		UnlockTTL:     cfg.UnlockTTL,
+		UnlockLimiter: unlockLimiter,
+
+		ScheduledPage:     scheduledPage,
+		ScheduledNotFound: cfg.ScheduledNotFound,
+	}
+	var metricsSrv *http.Server
+	if reg != nil {
+		registerStats(reg, rec, svc)
+		if threats != nil {
+			registerThreatStats(reg, threats)
+		}
+		routerOpts.Metrics = httpapi.NewMetrics(reg)
+		if cfg.MetricsAddr == "" {
+			routerOpts.MetricsHandler = reg.Handler()
+		} else {
+			mux := http.NewServeMux()
+			mux.Handle("GET /metrics", reg.Handler())
+			metricsSrv = &http.Server{
+				Addr:              cfg.MetricsAddr,
+				Handler:           mux,
+				ReadHeaderTimeout: cfg.ReadTimeout,
+			}
+		}
+	}
+	router := httpapi.NewRouter(svc, routerOpts)
+
+	// Expired-link janitor (disabled when PurgeInterval <= 0).
+	var jan *janitor
+	if cfg.PurgeInterval > 0 {
+		jan = startJanitor(svc, cfg.PurgeInterval, cfg.PurgeMode)
+	}
+
+	// Threat list hot reload (file polling plus SIGHUP while running).
+	var watcher *threatWatcher
+	if threats != nil {
+		watcher = startThreatWatcher(threats, cfg.ThreatReloadInterval)
+	}
 
 	return &App{
-		Cfg:     cfg,
-		Store:   store,
-		Service: svc,
-		Limiter: limiter,
-		Router:  router,
+		Cfg:      cfg,
+		Store:    store,
+		Service:  svc,
+		Recorder: rec,
+		Limiter:  limiter,
+		Router:   router,
+		Server: &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.Port),
+			Handler:           router,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		},
+		Logger:        logger,
+		Metrics:       reg,
+		MetricsServer: metricsSrv,
+		Threats:       threats,
+		janitor:       jan,
+		watcher:       watcher,
 	}, nil
 }
 
@@ -61,12 +218,119 @@ func (a *App) Addr() string {
 	return fmt.Sprintf(":%d", a.Cfg.Port)
 }
 
-// Start runs the HTTP server (blocking).
+// Start runs the HTTP server until SIGINT/SIGTERM, then shuts down gracefully.
 func (a *App) Start() error {
-	return a.Router.Run(a.Addr())
+	return a.Run(context.Background())
 }
 
-// Close releases resources (call on shutdown if you wire graceful stop).
+// Run serves HTTP until ctx is canceled or SIGINT/SIGTERM arrives. It then
+// stops accepting connections, drains in-flight requests within
+// Cfg.ShutdownTimeout, stops background workers and closes the store.
+func (a *App) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if a.watcher != nil {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go func() {
+			for {
+				select {
+				case <-hup:
+					log.Printf("SIGHUP: reloading threat list")
+					a.ReloadThreats()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	ln, err := net.Listen("tcp", a.Addr())
+	if err != nil {
+		_ = a.Close()
+		return err
+	}
+
+	if a.MetricsServer != nil {
+		mln, err := net.Listen("tcp", a.MetricsServer.Addr)
+		if err != nil {
+			_ = ln.Close()
+			_ = a.Close()
+			return fmt.Errorf("metrics listener: %w", err)
+		}
+		go func() {
+			if err := a.MetricsServer.Serve(mln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("metrics serve: %v", err)
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- a.Server.Serve(ln) }()
+
+	select {
+	case err := <-serveErr:
+		// Listener failed before any shutdown was requested.
+		_ = a.Close()
+		return err
+	case <-ctx.Done():
+	}
+	log.Printf("shutting down (draining for up to %s)", a.shutdownTimeout())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout())
+	defer cancel()
+	shutdownErr := a.Server.Shutdown(shutdownCtx)
+	if shutdownErr != nil {
+		log.Printf("http shutdown: %v", shutdownErr)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("http serve: %v", err)
+	}
+	if a.MetricsServer != nil {
+		// Scrapes are short; keep the endpoint up until traffic has drained.
+		if err := a.MetricsServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("metrics shutdown: %v", err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		return err
+	}
+	return shutdownErr
+}
+
+// ReloadThreats re-reads the threat list file if it changed. It returns
+// immediately; failures are logged and keep the previous list.
+func (a *App) ReloadThreats() {
+	if a.watcher != nil {
+		a.watcher.Reload()
+	}
+}
+
+// Close stops background workers (flushing pending click events) and closes
+// the store. It is idempotent; Run calls it on shutdown.
 func (a *App) Close() error {
-	return a.Store.Close()
+	a.closeOnce.Do(func() {
+		if a.janitor != nil {
+			a.janitor.Close()
+		}
+		if a.watcher != nil {
+			a.watcher.Close()
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout())
+		defer cancel()
+		if err := a.Recorder.Close(ctx); err != nil {
+			log.Printf("recorder close: %v", err)
+		}
+		a.closeErr = a.Store.Close()
+	})
+	return a.closeErr
+}
+
+func (a *App) shutdownTimeout() time.Duration {
+	if a.Cfg.ShutdownTimeout > 0 {
+		return a.Cfg.ShutdownTimeout
+	}
+	return defaultShutdownTimeout
 }
@@ -0,0 +1,48 @@
+package app_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"urlshorty/internal/app"
+	"urlshorty/internal/config"
+)
+
+func TestApp_RunStopsOnContextCancel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	a, err := app.New(context.Background(), config.Config{
+		Port:            0, // any free port
+		BaseURL:         "http://example",
+		DBPath:          ":memory:",
+		CodeLength:      7,
+		ShutdownTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("app.New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- a.Run(ctx) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	// Run closed the app; a second Close must be a no-op.
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close after Run: %v", err)
+	}
+}
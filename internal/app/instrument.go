@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"urlshorty/internal/core"
+	"urlshorty/internal/metrics"
+)
+
+// instrumentedStore times every call to the wrapped store in a
+// driver/op-labeled histogram.
+type instrumentedStore struct {
+	Store
+	driver string
+	dur    *metrics.HistogramVec
+}
+
+func instrumentStore(st Store, driver string, dur *metrics.HistogramVec) Store {
+	return &instrumentedStore{Store: st, driver: driver, dur: dur}
+}
+
+func (s *instrumentedStore) observe(op string, start time.Time) {
+	s.dur.ObserveSince(start, s.driver, op)
+}
+
+func (s *instrumentedStore) Create(ctx context.Context, u *core.URL) error {
+	defer s.observe("create", time.Now())
+	return s.Store.Create(ctx, u)
+}
+
+func (s *instrumentedStore) CreateBatch(ctx context.Context, recs []*core.URL, atomic bool) ([]error, error) {
+	defer s.observe("create_batch", time.Now())
+	return s.Store.CreateBatch(ctx, recs, atomic)
+}
+
+func (s *instrumentedStore) FindByCode(ctx context.Context, code string) (*core.URL, error) {
+	defer s.observe("find_by_code", time.Now())
+	return s.Store.FindByCode(ctx, code)
+}
+
+func (s *instrumentedStore) IncrementHits(ctx context.Context, code string) error {
+	defer s.observe("increment_hits", time.Now())
+	return s.Store.IncrementHits(ctx, code)
+}
+
+func (s *instrumentedStore) ConsumeHit(ctx context.Context, code string) (bool, error) {
+	defer s.observe("consume_hit", time.Now())
+	return s.Store.ConsumeHit(ctx, code)
+}
+
+func (s *instrumentedStore) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	defer s.observe("purge_expired", time.Now())
+	return s.Store.PurgeExpired(ctx, now)
+}
+
+func (s *instrumentedStore) ArchiveExpired(ctx context.Context, cutoff, now time.Time) (int64, error) {
+	defer s.observe("archive_expired", time.Now())
+	return s.Store.ArchiveExpired(ctx, cutoff, now)
+}
+
+func (s *instrumentedStore) FindByLongURL(ctx context.Context, q core.LongURLQuery) (*core.URL, error) {
+	defer s.observe("find_by_long_url", time.Now())
+	return s.Store.FindByLongURL(ctx, q)
+}
+
+func (s *instrumentedStore) Update(ctx context.Context, u *core.URL) error {
+	defer s.observe("update", time.Now())
+	return s.Store.Update(ctx, u)
+}
+
+func (s *instrumentedStore) Delete(ctx context.Context, code string) error {
+	defer s.observe("delete", time.Now())
+	return s.Store.Delete(ctx, code)
+}
+
+func (s *instrumentedStore) List(ctx context.Context, q core.ListQuery) ([]*core.URL, error) {
+	defer s.observe("list", time.Now())
+	return s.Store.List(ctx, q)
+}
+
+func (s *instrumentedStore) RecordClicks(ctx context.Context, evs []core.ClickEvent) error {
+	defer s.observe("record_clicks", time.Now())
+	return s.Store.RecordClicks(ctx, evs)
+}
+
+func (s *instrumentedStore) ClickStats(ctx context.Context, code string, q core.StatsQuery) (*core.ClickStats, error) {
+	defer s.observe("click_stats", time.Now())
+	return s.Store.ClickStats(ctx, code, q)
+}
+
+func (s *instrumentedStore) CreateAPIKey(ctx context.Context, k *core.APIKey, hash string) error {
+	defer s.observe("create_api_key", time.Now())
+	return s.Store.CreateAPIKey(ctx, k, hash)
+}
+
+func (s *instrumentedStore) FindAPIKeyByHash(ctx context.Context, hash string) (*core.APIKey, error) {
+	defer s.observe("find_api_key", time.Now())
+	return s.Store.FindAPIKeyByHash(ctx, hash)
+}
+
+func (s *instrumentedStore) ListAPIKeys(ctx context.Context) ([]*core.APIKey, error) {
+	defer s.observe("list_api_keys", time.Now())
+	return s.Store.ListAPIKeys(ctx)
+}
+
+func (s *instrumentedStore) RevokeAPIKey(ctx context.Context, id int64, at time.Time) error {
+	defer s.observe("revoke_api_key", time.Now())
+	return s.Store.RevokeAPIKey(ctx, id, at)
+}
+
+// registerStats exposes the recorder and cache counters kept by core.
+func registerStats(reg *metrics.Registry, rec *core.Recorder, svc *core.Service) {
+	recorder := func(f func(core.RecorderStats) float64) func() float64 {
+		return func() float64 { return f(rec.Stats()) }
+	}
+	reg.CounterFunc("urlshorty_clicks_enqueued_total", "Click events accepted by the recorder queue.",
+		recorder(func(s core.RecorderStats) float64 { return float64(s.Enqueued) }))
+	reg.CounterFunc("urlshorty_clicks_dropped_total", "Click events dropped because the queue was full or closed.",
+		recorder(func(s core.RecorderStats) float64 { return float64(s.Dropped) }))
+	reg.CounterFunc("urlshorty_clicks_blocked_total", "Redirects that waited for room in a full click queue (HIT_ENQUEUE_TIMEOUT).",
+		recorder(func(s core.RecorderStats) float64 { return float64(s.Blocked) }))
+	reg.CounterFunc("urlshorty_clicks_flushed_total", "Click events written to the store.",
+		recorder(func(s core.RecorderStats) float64 { return float64(s.Flushed) }))
+	reg.CounterFunc("urlshorty_clicks_failed_total", "Click events lost to store errors.",
+		recorder(func(s core.RecorderStats) float64 { return float64(s.Failed) }))
+	reg.GaugeFunc("urlshorty_clicks_queue_length", "Click events waiting in the recorder queue.",
+		recorder(func(s core.RecorderStats) float64 { return float64(s.QueueLen) }))
+
+	if _, ok := svc.CacheStats(); !ok {
+		return
+	}
+	cache := func(f func(core.CacheStats) float64) func() float64 {
+		return func() float64 {
+			st, _ := svc.CacheStats()
+			return f(st)
+		}
+	}
+	reg.CounterFunc("urlshorty_cache_hits_total", "Redirect lookups answered by the cache.",
+		cache(func(s core.CacheStats) float64 { return float64(s.Hits) }))
+	reg.CounterFunc("urlshorty_cache_misses_total", "Redirect lookups that went to the store.",
+		cache(func(s core.CacheStats) float64 { return float64(s.Misses) }))
+	reg.CounterFunc("urlshorty_cache_evictions_total", "Cache entries evicted to respect CACHE_SIZE.",
+		cache(func(s core.CacheStats) float64 { return float64(s.Evictions) }))
+	reg.CounterFunc("urlshorty_cache_invalidations_total", "Cache entries dropped because their link changed.",
+		cache(func(s core.CacheStats) float64 { return float64(s.Invalidations) }))
+	reg.GaugeFunc("urlshorty_cache_entries", "Links currently held by the cache.",
+		cache(func(s core.CacheStats) float64 { return float64(s.Len) }))
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"urlshorty/internal/core"
+)
+
+// janitor periodically reaps expired links via Service.CleanupExpired.
+type janitor struct {
+	svc      *core.Service
+	interval time.Duration
+	mode     string // "delete" or "archive", for logging only
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func startJanitor(svc *core.Service, interval time.Duration, mode string) *janitor {
+	j := &janitor{
+		svc:      svc,
+		interval: interval,
+		mode:     mode,
+		stop:     make(chan struct{}),
+	}
+	j.wg.Add(1)
+	go j.loop()
+	return j
+}
+
+func (j *janitor) loop() {
+	defer j.wg.Done()
+	t := time.NewTicker(j.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			j.runOnce()
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+func (j *janitor) runOnce() {
+	// Never let a slow run outlive the next tick.
+	ctx, cancel := context.WithTimeout(context.Background(), j.interval)
+	defer cancel()
+	n, err := j.svc.CleanupExpired(ctx)
+	if err != nil {
+		log.Printf("janitor: cleanup failed: %v", err)
+		return
+	}
+	log.Printf("janitor: reaped %d expired link(s) (mode=%s)", n, j.mode)
+}
+
+// Close stops the janitor and waits for an in-progress run to finish.
+func (j *janitor) Close() {
+	close(j.stop)
+	j.wg.Wait()
+}
@@ -0,0 +1,18 @@
+package app
+
+import (
+	"io"
+	"log/slog"
+
+	"urlshorty/internal/config"
+)
+
+// NewLogger builds the process logger described by cfg.LogFormat and
+// cfg.LogLevel, writing to w.
+func NewLogger(cfg config.Config, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.LogLevel}
+	if cfg.LogFormat == config.LogText {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"urlshorty/internal/config"
+	"urlshorty/internal/core"
+)
+
+// newURLPolicy builds the destination policy from cfg, reading the allow
+// and deny list files if configured. Links back to cfg.BaseURL are refused.
+func newURLPolicy(cfg config.Config) (*core.HostPolicy, error) {
+	allow, err := readHostList(cfg.URLAllowlistFile)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := readHostList(cfg.URLDenylistFile)
+	if err != nil {
+		return nil, err
+	}
+	opts := core.HostPolicyOptions{
+		Allow:        allow,
+		Deny:         deny,
+		AllowPrivate: cfg.AllowPrivateURLs,
+	}
+	if cfg.BaseURL != "" {
+		opts.Self = []string{cfg.BaseURL}
+	}
+	p, err := core.NewHostPolicy(opts)
+	if err != nil {
+		return nil, fmt.Errorf("url policy: %w", err)
+	}
+	return p, nil
+}
+
+func readHostList(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("url policy: %w", err)
+	}
+	defer f.Close()
+	hosts, err := core.ReadHostList(f)
+	if err != nil {
+		return nil, fmt.Errorf("url policy: read %s: %w", path, err)
+	}
+	return hosts, nil
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+
+	"urlshorty/internal/config"
+	"urlshorty/internal/core"
+	"urlshorty/internal/store/memory"
+	"urlshorty/internal/store/migrate"
+	"urlshorty/internal/store/postgres"
+	"urlshorty/internal/store/sqlite"
+)
+
+// Store is what the app needs from a storage backend.
+type Store interface {
+	core.FullStore
+	Close() error
+}
+
+// openStore opens the backend selected by cfg.DBDriver and applies migrations.
+func openStore(cfg config.Config) (Store, error) {
+	switch cfg.DBDriver {
+	case config.DriverSQLite, "":
+		st, err := sqlite.Open(cfg.DBPath)
+		if err != nil {
+			return nil, fmt.Errorf("open sqlite: %w", err)
+		}
+		return st, nil
+	case config.DriverPostgres:
+		if cfg.DatabaseURL == "" {
+			return nil, fmt.Errorf("DB_DRIVER=postgres requires DATABASE_URL")
+		}
+		st, err := postgres.Open(cfg.DatabaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("open postgres: %w", err)
+		}
+		return st, nil
+	case config.DriverMemory:
+		st, err := memory.Open(cfg.MemorySnapshot)
+		if err != nil {
+			return nil, fmt.Errorf("open memory store: %w", err)
+		}
+		return st, nil
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q", cfg.DBDriver)
+	}
+}
+
+// OpenMigrator opens the configured database without migrating it and
+// returns its migration runner. Callers must close the returned *sql.DB.
+func OpenMigrator(cfg config.Config) (*migrate.Migrator, *sql.DB, error) {
+	var (
+		db  *sql.DB
+		err error
+		m   *migrate.Migrator
+	)
+	switch cfg.DBDriver {
+	case config.DriverSQLite, "":
+		if db, err = sqlite.OpenDB(cfg.DBPath); err == nil {
+			m, err = sqlite.NewMigrator(db)
+		}
+	case config.DriverPostgres:
+		if cfg.DatabaseURL == "" {
+			return nil, nil, fmt.Errorf("DB_DRIVER=postgres requires DATABASE_URL")
+		}
+		if db, err = postgres.OpenDB(cfg.DatabaseURL); err == nil {
+			m, err = postgres.NewMigrator(db)
+		}
+	case config.DriverMemory:
+		return nil, nil, fmt.Errorf("DB_DRIVER=memory has no schema to migrate")
+	default:
+		return nil, nil, fmt.Errorf("unknown DB_DRIVER %q", cfg.DBDriver)
+	}
+	if err != nil {
+		if db != nil {
+			_ = db.Close()
+		}
+		return nil, nil, err
+	}
+	return m, db, nil
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"urlshorty/internal/metrics"
+	"urlshorty/internal/threat"
+)
+
+// threatWatcher reloads the threat list whenever its file changes, checking
+// every interval and on demand (SIGHUP).
+type threatWatcher struct {
+	list     *threat.List
+	interval time.Duration
+
+	reload chan struct{}
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func startThreatWatcher(list *threat.List, interval time.Duration) *threatWatcher {
+	w := &threatWatcher{
+		list:     list,
+		interval: interval,
+		reload:   make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.loop()
+	return w
+}
+
+func (w *threatWatcher) loop() {
+	defer w.wg.Done()
+	var tick <-chan time.Time
+	if w.interval > 0 {
+		t := time.NewTicker(w.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-tick:
+			w.runOnce()
+		case <-w.reload:
+			w.runOnce()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *threatWatcher) runOnce() {
+	changed, err := w.list.Reload()
+	if err != nil {
+		log.Printf("threat list: reload failed, keeping previous version: %v", err)
+		return
+	}
+	if changed {
+		st := w.list.Stats()
+		log.Printf("threat list: loaded %d domain(s) and %d hash prefix(es)", st.Domains, st.Prefixes)
+	}
+}
+
+// Reload asks the watcher to re-read the list without waiting for the next tick.
+func (w *threatWatcher) Reload() {
+	select {
+	case w.reload <- struct{}{}:
+	default: // a reload is already pending
+	}
+}
+
+// Close stops the watcher and waits for an in-progress reload to finish.
+func (w *threatWatcher) Close() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+func registerThreatStats(reg *metrics.Registry, list *threat.List) {
+	reg.GaugeFunc("urlshorty_threat_list_entries", "Domains and hash prefixes in the loaded threat list.",
+		func() float64 {
+			st := list.Stats()
+			return float64(st.Domains + st.Prefixes)
+		})
+	reg.GaugeFunc("urlshorty_threat_list_loaded_timestamp_seconds", "Unix time the threat list was last (re)loaded.",
+		func() float64 { return float64(list.Stats().LoadedAt.Unix()) })
+}
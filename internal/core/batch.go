@@ -0,0 +1,199 @@
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// maxBatchPasswords caps the password-protected requests in one batch; each
+// costs a bcrypt hash, far more CPU than the rate-limit token it is charged.
+const maxBatchPasswords = 10
+
+// BatchResult is the outcome of one request of a ShortenBatch call: the
+// link, or the error Shorten would have returned for it.
+type BatchResult struct {
+	URL    *URL
+	Reused bool // URL is an existing link returned by dedupe
+	Err    error
+}
+
+// ShortenBatch creates a link for every request, like ShortenOrReuse, and
+// inserts them in one store transaction. Results are in request order.
+//
+// Without atomic, every valid request is created and the others carry their
+// error. With atomic, either all links are created or none: when any request
+// fails, the rest report ErrBatchAborted. The returned error is reserved for
+// failures of the whole batch (auth, more than maxBatchPasswords passwords,
+// store errors); all-or-nothing batches need a BatchStore and fail with
+// ErrUnsupported otherwise. Passwords are hashed only after every request
+// was validated, and not at all when an all-or-nothing batch fails.
+func (s *Service) ShortenBatch(ctx context.Context, in []CreateRequest, atomic bool) ([]BatchResult, error) {
+	if PrincipalFrom(ctx) == nil && s.requireAuth {
+		return nil, ErrUnauthorized
+	}
+	passwords := 0
+	for _, req := range in {
+		if req.Password != "" {
+			passwords++
+		}
+	}
+	if passwords > maxBatchPasswords {
+		return nil, ErrBatchPasswords
+	}
+	res := make([]BatchResult, len(in))
+	if s.batch == nil {
+		if atomic {
+			return nil, ErrUnsupported
+		}
+		for i, req := range in {
+			rec, reused, err := s.ShortenOrReuse(ctx, req)
+			if err != nil && !isItemError(err) {
+				return nil, err
+			}
+			res[i] = BatchResult{URL: rec, Reused: reused, Err: err}
+		}
+		return res, nil
+	}
+
+	recs := make([]*URL, len(in))
+	var pending []int // indexes of recs still to insert
+	for i, req := range in {
+		dup, err := s.findDuplicate(ctx, req)
+		if dup != nil {
+			res[i] = BatchResult{URL: dup, Reused: true}
+			continue
+		}
+		if err == nil {
+			recs[i], err = s.newRecord(ctx, req)
+		}
+		if err != nil {
+			if !isItemError(err) {
+				return nil, err
+			}
+			res[i].Err = err
+			continue
+		}
+		pending = append(pending, i)
+	}
+	if atomic && abortBatch(res) {
+		return res, nil
+	}
+	for _, i := range pending {
+		var err error
+		if recs[i].PasswordHash, err = hashPassword(in[i].Password); err != nil {
+			return nil, err
+		}
+	}
+
+	// Generated codes that collide are redrawn and the insert retried; with
+	// atomic that means the whole batch, since the store rolled it back.
+	generated := make(map[int]bool)
+	for _, i := range pending {
+		if recs[i].Code == "" {
+			generated[i] = true
+		}
+	}
+	redraw := pending
+	for attempt := 0; len(pending) > 0; attempt++ {
+		for _, i := range redraw {
+			if !generated[i] {
+				continue
+			}
+			code, err := s.newCode(ctx)
+			if err != nil {
+				return nil, err
+			}
+			recs[i].Code = code
+		}
+		batch := make([]*URL, len(pending))
+		for j, i := range pending {
+			batch[j] = recs[i]
+		}
+		errs, err := s.batch.CreateBatch(ctx, batch, atomic)
+		if err != nil {
+			return nil, err
+		}
+		var retry []int
+		for j, i := range pending {
+			switch e := errs[j]; {
+			case e == nil:
+				if !atomic {
+					res[i].URL = recs[i]
+				}
+			case IsConflict(e) && generated[i] && attempt+1 < generateRetries:
+				LoggerFrom(ctx).Debug("generated code collided, retrying", "code", recs[i].Code, "attempt", attempt+1)
+				retry = append(retry, i)
+			case IsConflict(e):
+				res[i].Err = ErrConflict
+			default:
+				res[i].Err = e
+			}
+		}
+		if !atomic {
+			pending, redraw = retry, retry
+			continue
+		}
+		if abortBatch(res) {
+			return res, nil
+		}
+		if len(retry) == 0 {
+			for _, i := range pending {
+				res[i].URL = recs[i]
+			}
+			break
+		}
+		redraw = retry
+	}
+	for _, r := range res {
+		if r.URL != nil && !r.Reused {
+			s.invalidate(r.URL.Code)
+		}
+	}
+	return res, nil
+}
+
+// newCode draws a generated code, skipping invalid ones.
+func (s *Service) newCode(ctx context.Context) (string, error) {
+	for i := 0; i < generateRetries; i++ {
+		code, err := s.gen.NewCode(ctx)
+		if err != nil {
+			return "", err
+		}
+		if validAlias(code) {
+			return code, nil
+		}
+	}
+	return "", ErrConflict
+}
+
+// abortBatch reports whether any result failed and, if so, marks every
+// other one ErrBatchAborted.
+func abortBatch(res []BatchResult) bool {
+	failed := false
+	for _, r := range res {
+		if r.Err != nil {
+			failed = true
+			break
+		}
+	}
+	if !failed {
+		return false
+	}
+	for i := range res {
+		if res[i].Err == nil {
+			res[i] = BatchResult{Err: ErrBatchAborted}
+		}
+	}
+	return true
+}
+
+// isItemError reports whether err concerns a single request rather than the
+// whole batch.
+func isItemError(err error) bool {
+	switch err {
+	case ErrInvalidURL, ErrInvalidCode, ErrInvalidRedirect, ErrInvalidPassword, ErrInvalidMaxHits,
+		ErrInvalidWindow, ErrBlockedURL, ErrConflict, ErrUnsupported:
+		return true
+	}
+	return errors.Is(err, ErrInvalidTTL)
+}
@@ -0,0 +1,114 @@
+package core_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"urlshorty/internal/core"
+)
+
+// seqGen hands out codes in order.
+type seqGen struct{ codes []string }
+
+func (g *seqGen) NewCode(context.Context) (string, error) {
+	code := g.codes[0]
+	g.codes = g.codes[1:]
+	return code, nil
+}
+
+func TestShortenBatch(t *testing.T) {
+	ctx := context.Background()
+	st := openStore(t)
+	if err := st.Create(ctx, &core.URL{Code: "taken", LongURL: "https://example.com/"}); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	gen := &seqGen{}
+	svc := core.NewService(st, gen, core.Options{})
+
+	// Partial: bad items fail alone; a generated code that collides is redrawn.
+	gen.codes = []string{"taken", "gen-1", "gen-2"}
+	res, err := svc.ShortenBatch(ctx, []core.CreateRequest{
+		{URL: "https://example.com/a"},
+		{URL: "ftp://example.com/"},
+		{URL: "https://example.com/b", Custom: "taken"},
+		{URL: "https://example.com/c", Custom: "custom-c"},
+		{URL: "https://example.com/d"},
+	}, false)
+	if err != nil {
+		t.Fatalf("partial: %v", err)
+	}
+	want := []struct {
+		code string
+		err  error
+	}{{"gen-2", nil}, {"", core.ErrInvalidURL}, {"", core.ErrConflict}, {"custom-c", nil}, {"gen-1", nil}}
+	for i, w := range want {
+		r := res[i]
+		if r.Err != w.err || (w.err == nil && (r.URL == nil || r.URL.Code != w.code)) {
+			t.Errorf("item %d: got %+v, want code %q err %v", i, r, w.code, w.err)
+		}
+	}
+	if _, err := st.FindByCode(ctx, "gen-2"); err != nil { // the redrawn code
+		t.Fatalf("gen-2 not stored: %v", err)
+	}
+
+	// All-or-nothing: one conflict fails the batch and creates nothing.
+	gen.codes = []string{"gen-3"}
+	res, err = svc.ShortenBatch(ctx, []core.CreateRequest{
+		{URL: "https://example.com/e"},
+		{URL: "https://example.com/f", Custom: "custom-c"},
+	}, true)
+	if err != nil || res[0].Err != core.ErrBatchAborted || res[1].Err != core.ErrConflict {
+		t.Fatalf("atomic: res=%+v err=%v", res, err)
+	}
+	if _, err := st.FindByCode(ctx, "gen-3"); !core.IsNotFound(err) {
+		t.Fatalf("gen-3 stored despite the rollback: %v", err)
+	}
+
+	// All-or-nothing with a colliding generated code retries the whole batch.
+	gen.codes = []string{"gen-1", "gen-4"}
+	res, err = svc.ShortenBatch(ctx, []core.CreateRequest{
+		{URL: "https://example.com/g", Custom: "custom-g"},
+		{URL: "https://example.com/h"},
+	}, true)
+	if err != nil || res[0].Err != nil || res[1].Err != nil || res[1].URL.Code != "gen-4" {
+		t.Fatalf("atomic retry: res=%+v err=%v", res, err)
+	}
+	if _, err := st.FindByCode(ctx, "custom-g"); err != nil {
+		t.Fatalf("custom-g not stored: %v", err)
+	}
+}
+
+func TestShortenBatch_Passwords(t *testing.T) {
+	ctx := context.Background()
+	st := openStore(t)
+	svc := core.NewService(st, &seqGen{codes: []string{"gen-1", "gen-2"}}, core.Options{})
+
+	// A protected item is created hashed; an invalid one fails the batch.
+	res, err := svc.ShortenBatch(ctx, []core.CreateRequest{
+		{URL: "https://example.com/a", Custom: "locked", Password: "secret"},
+		{URL: "ftp://example.com/"},
+	}, true)
+	if err != nil || res[0].Err != core.ErrBatchAborted || res[1].Err != core.ErrInvalidURL {
+		t.Fatalf("atomic: res=%+v err=%v", res, err)
+	}
+	res, err = svc.ShortenBatch(ctx, []core.CreateRequest{
+		{URL: "https://example.com/a", Custom: "locked", Password: "secret"},
+		{URL: "https://example.com/b", Password: strings.Repeat("x", 73)},
+	}, false)
+	if err != nil || res[0].Err != nil || res[1].Err != core.ErrInvalidPassword {
+		t.Fatalf("partial: res=%+v err=%v", res, err)
+	}
+	if _, err := svc.Unlock(ctx, "locked", "secret"); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+
+	// Past the cap the whole batch is refused.
+	in := make([]core.CreateRequest, 11)
+	for i := range in {
+		in[i] = core.CreateRequest{URL: "https://example.com/c", Password: "pw"}
+	}
+	if _, err := svc.ShortenBatch(ctx, in, false); err != core.ErrBatchPasswords {
+		t.Fatalf("11 passwords: got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCacheTTL         = 5 * time.Minute
+	defaultCacheNegativeTTL = 30 * time.Second
+)
+
+// CacheOptions tunes the link cache. Size must be positive; zero durations use defaults.
+type CacheOptions struct {
+	Size        int           // maximum number of cached codes (LRU eviction beyond that)
+	TTL         time.Duration // how long a found link is served from memory (default 5m)
+	NegativeTTL time.Duration // how long an unknown code is remembered as missing (default 30s)
+}
+
+// CacheStats is a point-in-time snapshot of cache counters.
+type CacheStats struct {
+	Hits          uint64 `json:"hits"`          // lookups answered from memory (negative hits included)
+	Misses        uint64 `json:"misses"`        // lookups that went to the store
+	Evictions     uint64 `json:"evictions"`     // entries dropped to respect Size
+	Invalidations uint64 `json:"invalidations"` // entries dropped because the link changed
+	Len           int    `json:"len"`           // entries currently held
+}
+
+// Cache is a size-bounded LRU of link records keyed by code, used by
+// Service.Resolve to keep redirects off the store. Entries never outlive
+// their TTL or the link's own ExpiresAt, unknown codes are cached negatively
+// for NegativeTTL, and links with MaxHits are not cached. Records handed out
+// are copies.
+type Cache struct {
+	opts CacheOptions
+	now  func() time.Time
+
+	mu    sync.Mutex
+	ll    *list.List               // front = most recently used
+	items map[string]*list.Element // code -> *cacheEntry element
+	gen   uint64                   // bumped by Invalidate; fills started earlier are dropped
+
+	hits, misses, evictions, invalidations atomic.Uint64
+}
+
+type cacheEntry struct {
+	code    string
+	rec     *URL // nil = negative entry (code does not exist)
+	expires time.Time
+}
+
+// NewCache returns an empty cache, or nil when opts.Size <= 0 (caching disabled).
+func NewCache(opts CacheOptions) *Cache {
+	if opts.Size <= 0 {
+		return nil
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultCacheTTL
+	}
+	if opts.NegativeTTL <= 0 {
+		opts.NegativeTTL = defaultCacheNegativeTTL
+	}
+	return &Cache{
+		opts:  opts,
+		now:   time.Now,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached record for code. found reports a cache hit; a hit
+// with a nil record means the code is known not to exist. On a miss, gen
+// must be passed to the put/putMissing that fills the entry.
+func (c *Cache) get(code string) (rec *URL, found bool, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[code]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false, c.gen
+	}
+	e := el.Value.(*cacheEntry)
+	if !c.now().Before(e.expires) {
+		c.removeElement(el)
+		c.misses.Add(1)
+		return nil, false, c.gen
+	}
+	c.ll.MoveToFront(el)
+	c.hits.Add(1)
+	if e.rec == nil {
+		return nil, true, c.gen
+	}
+	return copyURL(e.rec), true, c.gen
+}
+
+// put caches rec under its code until the TTL elapses or the link expires,
+// whichever comes first. Already expired records are not cached, nor are
+// capped ones: their UsedHits changes with every redirect.
+func (c *Cache) put(rec *URL, gen uint64) {
+	if rec.MaxHits > 0 {
+		return
+	}
+	now := c.now()
+	expires := now.Add(c.opts.TTL)
+	if rec.ExpiresAt != nil {
+		if !rec.ExpiresAt.After(now) {
+			return
+		}
+		if rec.ExpiresAt.Before(expires) {
+			expires = *rec.ExpiresAt
+		}
+	}
+	c.set(&cacheEntry{code: rec.Code, rec: copyURL(rec), expires: expires}, gen)
+}
+
+// putMissing remembers that code does not exist.
+func (c *Cache) putMissing(code string, gen uint64) {
+	c.set(&cacheEntry{code: code, expires: c.now().Add(c.opts.NegativeTTL)}, gen)
+}
+
+// set stores e unless an invalidation happened since gen was read, in which
+// case the value may predate a write and is dropped.
+func (c *Cache) set(e *cacheEntry, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if el, ok := c.items[e.code]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[e.code] = c.ll.PushFront(e)
+	for c.ll.Len() > c.opts.Size {
+		c.removeElement(c.ll.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// Invalidate drops code from the cache. Service calls it whenever a link is
+// created, updated or deleted; other writers to the store must do the same.
+func (c *Cache) Invalidate(code string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if el, ok := c.items[code]; ok {
+		c.removeElement(el)
+		c.invalidations.Add(1)
+	}
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	n := c.ll.Len()
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Evictions:     c.evictions.Load(),
+		Invalidations: c.invalidations.Load(),
+		Len:           n,
+	}
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).code)
+}
+
+// copyURL returns a copy of u that shares no pointers with it.
+func copyURL(u *URL) *URL {
+	c := *u
+	if u.ExpiresAt != nil {
+		t := *u.ExpiresAt
+		c.ExpiresAt = &t
+	}
+	if u.StartsAt != nil {
+		t := *u.StartsAt
+		c.StartsAt = &t
+	}
+	if u.ArchivedAt != nil {
+		t := *u.ArchivedAt
+		c.ArchivedAt = &t
+	}
+	if u.StatusChangedAt != nil {
+		t := *u.StatusChangedAt
+		c.StatusChangedAt = &t
+	}
+	return &c
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// findStore serves FindByCode/Update/Delete from a map and counts lookups;
+// other Store methods are unused.
+type findStore struct {
+	Store
+	mu    sync.Mutex
+	urls  map[string]*URL
+	finds int
+}
+
+func (s *findStore) FindByCode(_ context.Context, code string) (*URL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finds++
+	u, ok := s.urls[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyURL(u), nil
+}
+
+func (s *findStore) Update(_ context.Context, u *URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.urls[u.Code] = copyURL(u)
+	return nil
+}
+
+func (s *findStore) Delete(_ context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.urls, code)
+	return nil
+}
+
+func (s *findStore) lookups() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.finds
+}
+
+func newCachedService(t *testing.T, now *time.Time, urls ...*URL) (*Service, *findStore, *Cache) {
+	t.Helper()
+	st := &findStore{urls: make(map[string]*URL)}
+	for _, u := range urls {
+		st.urls[u.Code] = u
+	}
+	c := NewCache(CacheOptions{Size: 2, TTL: time.Minute, NegativeTTL: 10 * time.Second})
+	c.now = func() time.Time { return *now }
+	svc := NewService(st, nil, Options{Cache: c})
+	svc.nowFunc = c.now
+	return svc, st, c
+}
+
+func TestCache_ServesRepeatLookupsFromMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	svc, st, c := newCachedService(t, &now, &URL{Code: "abc", LongURL: "https://a.example"})
+
+	for i := 0; i < 3; i++ {
+		rec, err := svc.Resolve(ctx, "abc")
+		if err != nil || rec.LongURL != "https://a.example" {
+			t.Fatalf("resolve %d: %+v err=%v", i, rec, err)
+		}
+		rec.LongURL = "mutated" // must not leak into the cache
+	}
+	if n := st.lookups(); n != 1 {
+		t.Fatalf("expected 1 store lookup, got %d", n)
+	}
+	if s := c.Stats(); s.Hits != 2 || s.Misses != 1 || s.Len != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	// TTL elapses: the next lookup goes back to the store.
+	now = now.Add(2 * time.Minute)
+	if _, err := svc.Resolve(ctx, "abc"); err != nil {
+		t.Fatalf("resolve after ttl: %v", err)
+	}
+	if n := st.lookups(); n != 2 {
+		t.Fatalf("expected refetch after TTL, got %d lookups", n)
+	}
+}
+
+func TestCache_NegativeEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	svc, st, _ := newCachedService(t, &now)
+
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Resolve(ctx, "nope"); !IsNotFound(err) {
+			t.Fatalf("resolve %d: expected not found, got %v", i, err)
+		}
+	}
+	if n := st.lookups(); n != 1 {
+		t.Fatalf("negative entry not used: %d lookups", n)
+	}
+	now = now.Add(11 * time.Second)
+	_, _ = svc.Resolve(ctx, "nope")
+	if n := st.lookups(); n != 2 {
+		t.Fatalf("negative entry outlived NegativeTTL: %d lookups", n)
+	}
+}
+
+func TestCache_RespectsLinkExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	exp := now.Add(5 * time.Second)
+	svc, _, _ := newCachedService(t, &now, &URL{Code: "soon", LongURL: "https://a.example", ExpiresAt: &exp})
+
+	if _, err := svc.Resolve(ctx, "soon"); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	now = now.Add(6 * time.Second)
+	if _, err := svc.Resolve(ctx, "soon"); !IsExpired(err) {
+		t.Fatalf("expected expired after ExpiresAt, got %v", err)
+	}
+}
+
+func TestCache_SkipsCappedLinks(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	svc, st, c := newCachedService(t, &now, &URL{Code: "capped", LongURL: "https://a.example", MaxHits: 3})
+
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Resolve(ctx, "capped"); err != nil {
+			t.Fatalf("resolve %d: %v", i, err)
+		}
+	}
+	if n := st.lookups(); n != 2 {
+		t.Fatalf("capped link served from memory: %d lookups", n)
+	}
+	if s := c.Stats(); s.Len != 0 || s.Invalidations != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	svc, st, c := newCachedService(t, &now,
+		&URL{Code: "one", LongURL: "https://1.example"},
+		&URL{Code: "two", LongURL: "https://2.example"},
+		&URL{Code: "three", LongURL: "https://3.example"},
+	)
+	for _, code := range []string{"one", "two", "one", "three"} {
+		if _, err := svc.Resolve(ctx, code); err != nil {
+			t.Fatalf("resolve %s: %v", code, err)
+		}
+	}
+	// "two" was least recently used when "three" arrived.
+	before := st.lookups()
+	_, _ = svc.Resolve(ctx, "one")
+	_, _ = svc.Resolve(ctx, "two")
+	if n := st.lookups() - before; n != 1 {
+		t.Fatalf("expected only the evicted code to hit the store, got %d lookups", n)
+	}
+	if s := c.Stats(); s.Evictions != 2 || s.Len != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestCache_InvalidatedByUpdateAndDelete(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	svc, _, _ := newCachedService(t, &now, &URL{Code: "abc", LongURL: "https://old.example"})
+	admin := WithPrincipal(ctx, &Principal{Admin: true})
+
+	if _, err := svc.Resolve(ctx, "abc"); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	newURL := "https://new.example/"
+	if _, err := svc.Update(admin, "abc", UpdateRequest{URL: &newURL}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if rec, err := svc.Resolve(ctx, "abc"); err != nil || rec.LongURL != newURL {
+		t.Fatalf("stale record after update: %+v err=%v", rec, err)
+	}
+	if err := svc.Delete(admin, "abc"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := svc.Resolve(ctx, "abc"); !IsNotFound(err) {
+		t.Fatalf("expected not found after delete, got %v", err)
+	}
+}
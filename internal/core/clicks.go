@@ -0,0 +1,199 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	maxUserAgentLength = 512
+	maxStatsBuckets    = 1000
+	defaultTopN        = 10
+	maxTopN            = 100
+)
+
+// ClickSource carries the raw request details a click event is derived from.
+type ClickSource struct {
+	Referer   string // Referer header as sent by the client
+	UserAgent string // User-Agent header
+	ClientIP  string // Client IP as resolved by the HTTP layer
+}
+
+// RecordClick records a click event for code and increments its hits counter.
+// With a Recorder configured the event is queued and ErrClickDropped is
+// returned if the queue is full; otherwise it is written inline.
+func (s *Service) RecordClick(ctx context.Context, code string, src ClickSource) error {
+	if !validAlias(code) {
+		return ErrInvalidCode
+	}
+	ev := s.newClickEvent(code, src)
+	if s.rec != nil {
+		if !s.rec.Record(ev) {
+			LoggerFrom(ctx).Warn("click dropped: recorder queue full", "code", code)
+			return ErrClickDropped
+		}
+		return nil
+	}
+	return s.store.RecordClicks(ctx, []ClickEvent{ev})
+}
+
+// Stats returns time-bucketed click counts and top referrers for code.
+// Only the link's owner or an admin may view them.
+// Zero-valued fields in q are filled with defaults: daily buckets over the
+// last 30 days, or hourly buckets over the last 24 hours.
+func (s *Service) Stats(ctx context.Context, code string, q StatsQuery) (*ClickStats, error) {
+	if !validAlias(code) {
+		return nil, ErrInvalidCode
+	}
+	if s.stats == nil {
+		return nil, ErrUnsupported
+	}
+	q, err := s.normalizeStatsQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := s.store.FindByCode(ctx, code)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if err := authorizeOwner(ctx, rec); err != nil {
+		return nil, err
+	}
+	st, err := s.stats.ClickStats(ctx, code, q)
+	if err != nil {
+		return nil, err
+	}
+	st.Code = code
+	st.Bucket = q.Bucket
+	st.From = q.From
+	st.To = q.To
+	st.Series = fillBuckets(st.Series, q)
+	if st.TopReferrers == nil {
+		st.TopReferrers = []ReferrerCount{}
+	}
+	return st, nil
+}
+
+// BucketDuration returns the width of a stats bucket, or 0 if b is unknown.
+func BucketDuration(b StatsBucket) time.Duration {
+	switch b {
+	case BucketHour:
+		return time.Hour
+	case BucketDay:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// ---- helpers ----
+
+func (s *Service) newClickEvent(code string, src ClickSource) ClickEvent {
+	ua := strings.TrimSpace(src.UserAgent)
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	return ClickEvent{
+		Code:      code,
+		At:        s.nowFunc().UTC(),
+		Referrer:  referrerHost(src.Referer),
+		UserAgent: ua,
+		IPHash:    s.hashIP(src.ClientIP),
+	}
+}
+
+func (s *Service) hashIP(ip string) string {
+	ip = strings.TrimSpace(ip)
+	if ip == "" {
+		return ""
+	}
+	h := sha256.New()
+	h.Write(s.ipSalt)
+	h.Write([]byte(ip))
+	// 16 bytes is plenty to count distinct visitors.
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func (s *Service) normalizeStatsQuery(q StatsQuery) (StatsQuery, error) {
+	if q.Bucket == "" {
+		q.Bucket = BucketDay
+	}
+	width := BucketDuration(q.Bucket)
+	if width == 0 {
+		return q, ErrInvalidStats
+	}
+	if q.To.IsZero() {
+		q.To = s.nowFunc()
+	}
+	if q.From.IsZero() {
+		if q.Bucket == BucketHour {
+			q.From = q.To.Add(-24 * time.Hour)
+		} else {
+			q.From = q.To.Add(-30 * 24 * time.Hour)
+		}
+	}
+	// Align the window to bucket boundaries (UTC) so buckets are stable.
+	q.From = q.From.UTC().Truncate(width)
+	q.To = q.To.UTC()
+	if !q.To.Equal(q.To.Truncate(width)) {
+		q.To = q.To.Truncate(width).Add(width)
+	}
+	if !q.From.Before(q.To) {
+		return q, ErrInvalidStats
+	}
+	if q.To.Sub(q.From)/width > maxStatsBuckets {
+		return q, ErrInvalidStats
+	}
+	switch {
+	case q.TopN <= 0:
+		q.TopN = defaultTopN
+	case q.TopN > maxTopN:
+		q.TopN = maxTopN
+	}
+	return q, nil
+}
+
+// fillBuckets returns a dense series covering q's window, using zero counts
+// for buckets the store reported no clicks for.
+func fillBuckets(sparse []BucketCount, q StatsQuery) []BucketCount {
+	width := BucketDuration(q.Bucket)
+	counts := make(map[int64]int64, len(sparse))
+	for _, b := range sparse {
+		counts[b.Start.Unix()] += b.Count
+	}
+	out := make([]BucketCount, 0, q.To.Sub(q.From)/width)
+	for t := q.From; t.Before(q.To); t = t.Add(width) {
+		out = append(out, BucketCount{Start: t, Count: counts[t.Unix()]})
+	}
+	return out
+}
+
+// referrerHost reduces a Referer header to its lowercase host.
+func referrerHost(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func ipSalt(configured string) []byte {
+	if configured != "" {
+		return []byte(configured)
+	}
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return b
+}
@@ -4,12 +4,32 @@ import "errors"
 
 var (
 	// Operational/errors for control flow.
-	ErrNotFound    = errors.New("not found")
-	ErrConflict    = errors.New("code already exists")
-	ErrExpired     = errors.New("link expired")
-	ErrInvalidURL  = errors.New("invalid url")
-	ErrInvalidCode = errors.New("invalid code")
-	ErrRateLimited = errors.New("rate limited")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("code already exists")
+	ErrExpired         = errors.New("link expired")
+	ErrInvalidURL      = errors.New("invalid url")
+	ErrInvalidCode     = errors.New("invalid code")
+	ErrRateLimited     = errors.New("rate limited")
+	ErrInvalidStats    = errors.New("invalid stats query")
+	ErrClickDropped    = errors.New("click event dropped")
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrInvalidKeyName  = errors.New("invalid key name")
+	ErrUnsupported     = errors.New("not supported by this store")
+	ErrInvalidRedirect = errors.New("invalid redirect type")
+	ErrBlockedURL      = errors.New("destination not allowed")
+	ErrInvalidStatus   = errors.New("invalid status")
+	ErrDisabled        = errors.New("link disabled")
+	ErrQuarantined     = errors.New("link quarantined")
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrWrongPassword   = errors.New("wrong password")
+	ErrInvalidMaxHits  = errors.New("invalid max_hits")
+	ErrInvalidWindow   = errors.New("starts_at must be before expires_at")
+	ErrNotYetActive    = errors.New("link not active yet")
+	ErrInvalidTTL      = errors.New("invalid ttl") // wrapped by *TTLError with the reason
+	ErrBatchAborted    = errors.New("not created: another item in the batch failed")
+	ErrBatchPasswords  = errors.New("too many password-protected items in one batch")
 )
 
 // IsNotFound reports whether err is a not-found condition.
@@ -21,3 +41,5 @@ func IsConflict(err error) bool { return errors.Is(err, ErrConflict) }
 // IsExpired reports whether err indicates an expired resource.
 func IsExpired(err error) bool { return errors.Is(err, ErrExpired) }
 
+// IsUnauthorized reports whether err indicates missing or invalid credentials.
+func IsUnauthorized(err error) bool { return errors.Is(err, ErrUnauthorized) }
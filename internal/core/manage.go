@@ -0,0 +1,215 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+	maxReasonLength  = 500
+)
+
+// Update applies a partial update to an existing link and returns the result.
+// Only the link's owner or an admin may update it (only an admin once the
+// link is disabled or quarantined). Extending the expiry of an archived link
+// brings it back to life.
+func (s *Service) Update(ctx context.Context, code string, in UpdateRequest) (*URL, error) {
+	if !validAlias(code) {
+		return nil, ErrInvalidCode
+	}
+	rec, err := s.store.FindByCode(ctx, code)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if err := authorizeWrite(ctx, rec); err != nil {
+		return nil, err
+	}
+	if in.URL != nil {
+		longURL, err := s.destination(ctx, *in.URL)
+		if err != nil {
+			return nil, err
+		}
+		rec.LongURL = longURL
+	}
+	switch {
+	case in.ExpiresAt != nil:
+		if in.ExpiresAt.Before(s.nowFunc()) {
+			return nil, ErrInvalidURL
+		}
+		exp := in.ExpiresAt.UTC()
+		rec.ExpiresAt = &exp
+	case in.ClearExpiresAt:
+		rec.ExpiresAt = nil
+	}
+	if in.ExpiresAt != nil || in.ClearExpiresAt {
+		// Links created before a MaxTTL was set keep their expiry until it
+		// is changed.
+		if err := s.checkMaxTTL(rec.ExpiresAt); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case in.StartsAt != nil:
+		start := in.StartsAt.UTC()
+		rec.StartsAt = &start
+	case in.ClearStartsAt:
+		rec.StartsAt = nil
+	}
+	if !validWindow(rec.StartsAt, rec.ExpiresAt) {
+		return nil, ErrInvalidWindow
+	}
+	if in.RedirectType != nil {
+		if !ValidRedirectType(*in.RedirectType) {
+			return nil, ErrInvalidRedirect
+		}
+		rec.RedirectType = *in.RedirectType
+	}
+	if !isExpired(rec, s.nowFunc) {
+		rec.ArchivedAt = nil
+	}
+	err = s.store.Update(ctx, rec)
+	s.invalidate(code)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Delete removes a link and its click history (owner or admin only; admin
+// only once the link is disabled or quarantined).
+func (s *Service) Delete(ctx context.Context, code string) error {
+	if !validAlias(code) {
+		return ErrInvalidCode
+	}
+	rec, err := s.store.FindByCode(ctx, code)
+	if err != nil {
+		if IsNotFound(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if err := authorizeWrite(ctx, rec); err != nil {
+		return err
+	}
+	err = s.store.Delete(ctx, code)
+	s.invalidate(code)
+	if err != nil {
+		if IsNotFound(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// SetStatus disables, quarantines or reactivates a link (admin only) and
+// records the reason and time. Resolve then fails with ErrDisabled or
+// ErrQuarantined while Metadata keeps returning the record.
+func (s *Service) SetStatus(ctx context.Context, code, status, reason string) (*URL, error) {
+	if err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if !validAlias(code) {
+		return nil, ErrInvalidCode
+	}
+	status = strings.ToLower(strings.TrimSpace(status))
+	reason = strings.TrimSpace(reason)
+	if !ValidStatus(status) || len(reason) > maxReasonLength {
+		return nil, ErrInvalidStatus
+	}
+	rec, err := s.store.FindByCode(ctx, code)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	now := s.nowFunc().UTC()
+	rec.Status, rec.StatusReason, rec.StatusChangedAt = status, reason, &now
+	err = s.store.Update(ctx, rec)
+	s.invalidate(code)
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	LoggerFrom(ctx).Info("link status changed", "code", code, "status", status, "reason", reason)
+	return rec, nil
+}
+
+// List returns a page of links, newest first. cursor is the opaque
+// NextCursor of the previous page ("" for the first page).
+// Admins see every link; other keys see only the links they own.
+func (s *Service) List(ctx context.Context, cursor string, limit int) (*LinkPage, error) {
+	p := PrincipalFrom(ctx)
+	if p == nil {
+		return nil, ErrUnauthorized
+	}
+	if s.lister == nil {
+		return nil, ErrUnsupported
+	}
+	var q ListQuery
+	if !p.Admin {
+		q.OwnerID = p.KeyID
+	}
+	if cursor != "" {
+		id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		q.BeforeID = id
+	}
+	switch {
+	case limit <= 0:
+		q.Limit = defaultListLimit
+	case limit > maxListLimit:
+		q.Limit = maxListLimit
+	default:
+		q.Limit = limit
+	}
+	// Fetch one extra row to learn whether another page exists.
+	want := q.Limit
+	q.Limit++
+	links, err := s.lister.List(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	page := &LinkPage{Links: links}
+	if len(links) > want {
+		page.Links = links[:want]
+		page.NextCursor = encodeCursor(page.Links[want-1].ID)
+	}
+	if page.Links == nil {
+		page.Links = []*URL{}
+	}
+	return page, nil
+}
+
+// ---- helpers ----
+
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(c string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
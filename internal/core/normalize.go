@@ -0,0 +1,167 @@
+package core
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// NormalizeOptions controls the optional parts of URL canonicalization. The
+// zero value only applies the lossless rules (see normalizer.normalize).
+type NormalizeOptions struct {
+	// StripParams lists query parameters to drop, matched case-insensitively.
+	// A trailing "*" matches by prefix, e.g. "utm_*".
+	StripParams []string
+	// SortQuery orders the remaining query parameters by name (stable, so
+	// repeated parameters keep their relative order).
+	SortQuery bool
+}
+
+type normalizer struct {
+	strip    map[string]bool
+	prefixes []string
+	sort     bool
+}
+
+func newNormalizer(opts NormalizeOptions) normalizer {
+	n := normalizer{sort: opts.SortQuery}
+	for _, p := range opts.StripParams {
+		p = strings.ToLower(strings.TrimSpace(p))
+		switch {
+		case p == "" || p == "*":
+		case strings.HasSuffix(p, "*"):
+			n.prefixes = append(n.prefixes, strings.TrimSuffix(p, "*"))
+		default:
+			if n.strip == nil {
+				n.strip = make(map[string]bool)
+			}
+			n.strip[p] = true
+		}
+	}
+	return n
+}
+
+// normalize validates raw as an absolute http(s) URL and returns its
+// canonical form: lowercase scheme and host, internationalized hosts in
+// punycode, default ports removed, "." and ".." path segments resolved and an
+// empty path written as "/". Configured tracking parameters are stripped and
+// the query optionally sorted; the fragment is kept as is.
+func (n normalizer) normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || len(raw) > maxURLLength {
+		return "", ErrInvalidURL
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", ErrInvalidURL
+	}
+	// Require explicit http/https scheme and non-empty host.
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", ErrInvalidURL
+	}
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return "", ErrInvalidURL
+	}
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	// Resolving against the root removes dot segments without otherwise
+	// touching the (still escaped) path.
+	if u.Path == "" {
+		u.Path, u.RawPath = "/", ""
+	} else if strings.Contains(u.Path, ".") {
+		u.Path, u.RawPath = resolveDots(u)
+	}
+
+	u.RawQuery = n.query(u.RawQuery)
+	if u.RawQuery == "" {
+		u.ForceQuery = false
+	}
+
+	out := u.String()
+	if len(out) > maxURLLength {
+		return "", ErrInvalidURL
+	}
+	return out, nil
+}
+
+// canonicalHost lowercases host and converts internationalized names to
+// their ASCII (punycode) form. IP literals are returned in canonical notation.
+func canonicalHost(host string) (string, error) {
+	if host == "" {
+		return "", ErrInvalidURL
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	host = strings.TrimSuffix(host, ".")
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil || ascii == "" {
+		return "", ErrInvalidURL
+	}
+	return ascii, nil
+}
+
+func resolveDots(u *url.URL) (path, rawPath string) {
+	root := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+	r := root.ResolveReference(&url.URL{Path: u.Path, RawPath: u.RawPath})
+	return r.Path, r.RawPath
+}
+
+// query drops stripped parameters and optionally sorts the rest, working on
+// the raw form so the encoding of kept parameters is preserved.
+func (n normalizer) query(raw string) string {
+	if raw == "" || (n.strip == nil && n.prefixes == nil && !n.sort) {
+		return raw
+	}
+	type param struct{ name, raw string }
+	var kept []param
+	for _, part := range strings.Split(raw, "&") {
+		if part == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(part, "=")
+		if un, err := url.QueryUnescape(name); err == nil {
+			name = un
+		}
+		if n.stripped(name) {
+			continue
+		}
+		kept = append(kept, param{name, part})
+	}
+	if n.sort {
+		sort.SliceStable(kept, func(i, j int) bool { return kept[i].name < kept[j].name })
+	}
+	parts := make([]string, len(kept))
+	for i, p := range kept {
+		parts[i] = p.raw
+	}
+	return strings.Join(parts, "&")
+}
+
+func (n normalizer) stripped(name string) bool {
+	name = strings.ToLower(name)
+	if n.strip[name] {
+		return true
+	}
+	for _, p := range n.prefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package core
+
+import "testing"
+
+func TestNormalize_Canonicalizes(t *testing.T) {
+	plain := newNormalizer(NormalizeOptions{})
+	tracking := newNormalizer(NormalizeOptions{StripParams: []string{"utm_*", "fbclid", "GCLID"}, SortQuery: true})
+
+	cases := []struct {
+		name string
+		n    normalizer
+		in   string
+		want string
+	}{
+		{"scheme and host case", plain, "HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"empty path", plain, "https://example.com", "https://example.com/"},
+		{"default http port", plain, "http://example.com:80/a", "http://example.com/a"},
+		{"default https port", plain, "https://example.com:443/a", "https://example.com/a"},
+		{"other port kept", plain, "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"idna host", plain, "https://Bücher.example/ä", "https://xn--bcher-kva.example/%C3%A4"},
+		{"trailing dot host", plain, "https://example.com./", "https://example.com/"},
+		{"ipv6 literal", plain, "http://[2001:DB8::1]:80/", "http://[2001:db8::1]/"},
+		{"dot segments", plain, "https://example.com/a/./b/../c/", "https://example.com/a/c/"},
+		{"dot segments above root", plain, "https://example.com/../../a", "https://example.com/a"},
+		{"escaping preserved", plain, "https://example.com/a%2Fb/../c?q=a%20b", "https://example.com/c?q=a%20b"},
+		{"query untouched without options", plain, "https://example.com/?b=2&utm_source=x&a=1", "https://example.com/?b=2&utm_source=x&a=1"},
+		{"fragment kept", plain, "https://example.com/a#Top", "https://example.com/a#Top"},
+		{"tracking stripped and sorted", tracking, "https://example.com/?b=2&UTM_Source=x&fbclid=y&a=1&gclid=z&b=1", "https://example.com/?a=1&b=2&b=1"},
+		{"only tracking params", tracking, "https://example.com/p?utm_medium=email", "https://example.com/p"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.n.normalize(tc.in)
+			if err != nil {
+				t.Fatalf("normalize(%q): %v", tc.in, err)
+			}
+			if got != tc.want {
+				t.Fatalf("normalize(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNormalize_Rejects(t *testing.T) {
+	n := newNormalizer(NormalizeOptions{})
+	for _, in := range []string{
+		"",
+		"example.com/path",
+		"ftp://example.com/",
+		"https:///path",
+		"https://exa mple.com/",
+		"https://xn--a.example/", // invalid punycode
+	} {
+		if _, err := n.normalize(in); err != ErrInvalidURL {
+			t.Errorf("normalize(%q): expected ErrInvalidURL, got %v", in, err)
+		}
+	}
+}
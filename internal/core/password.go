@@ -0,0 +1,42 @@
+package core
+
+import (
+	"context"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength is bcrypt's input limit; longer passwords are refused
+// rather than silently truncated.
+const maxPasswordLength = 72
+
+// hashPassword returns the bcrypt hash of a link password, or "" for none.
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) > maxPasswordLength {
+		return "", ErrInvalidPassword
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+// Unlock resolves code like Resolve and checks password against a protected
+// link, returning ErrWrongPassword on mismatch. Links without a password
+// unlock with any input. Callers should throttle attempts: each check costs
+// a bcrypt comparison.
+func (s *Service) Unlock(ctx context.Context, code, password string) (*URL, error) {
+	rec, err := s.Resolve(ctx, code)
+	if err != nil || !rec.Protected() {
+		return rec, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(rec.PasswordHash), []byte(password)) != nil {
+		LoggerFrom(ctx).Info("wrong link password", "code", code)
+		return nil, ErrWrongPassword
+	}
+	return rec, nil
+}
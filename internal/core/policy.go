@@ -0,0 +1,212 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// URLPolicy decides whether a destination may be shortened. Check receives
+// the canonical URL (see NormalizeOptions) and returns ErrBlockedURL to
+// refuse it; any other error is treated as an internal failure.
+type URLPolicy interface {
+	Check(ctx context.Context, u *url.URL) error
+}
+
+// ThreatMatcher reports whether a destination is on a threat list (phishing,
+// malware, ...) and under which threat type. Unlike URLPolicy it is
+// consulted again on every redirect, so links whose destination turns bad
+// after creation are caught as well.
+type ThreatMatcher interface {
+	Match(u *url.URL) (threat string, ok bool)
+}
+
+// HostPolicyOptions configures NewHostPolicy. Host patterns are either an
+// exact host ("example.com", "203.0.113.7"), a wildcard matching every
+// subdomain but not the domain itself ("*.example.com"), or an IP prefix
+// matching IP literals ("10.0.0.0/8").
+type HostPolicyOptions struct {
+	// Allow, when non-empty, refuses every host that matches none of its patterns.
+	Allow []string
+	// Deny refuses hosts matching any of its patterns. It wins over Allow.
+	Deny []string
+	// AllowPrivate accepts loopback, private, link-local and other
+	// non-routable IP literals as well as "localhost", which are refused by
+	// default.
+	AllowPrivate bool
+	// Self lists the service's own base URLs; links back to their hosts are
+	// refused so short links cannot redirect to each other in loops.
+	Self []string
+}
+
+// HostPolicy is the built-in URLPolicy, deciding on the destination host alone.
+type HostPolicy struct {
+	allow        hostSet
+	deny         hostSet
+	self         map[string]bool
+	allowPrivate bool
+}
+
+// Compile-time check: *HostPolicy implements URLPolicy.
+var _ URLPolicy = (*HostPolicy)(nil)
+
+// NewHostPolicy validates the patterns in opts and builds the policy.
+func NewHostPolicy(opts HostPolicyOptions) (*HostPolicy, error) {
+	p := &HostPolicy{self: make(map[string]bool), allowPrivate: opts.AllowPrivate}
+	var err error
+	if p.allow, err = newHostSet(opts.Allow); err != nil {
+		return nil, fmt.Errorf("allow list: %w", err)
+	}
+	if p.deny, err = newHostSet(opts.Deny); err != nil {
+		return nil, fmt.Errorf("deny list: %w", err)
+	}
+	for _, raw := range opts.Self {
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("self url %q: not an absolute url", raw)
+		}
+		host, err := canonicalHost(u.Hostname())
+		if err != nil {
+			return nil, fmt.Errorf("self url %q: invalid host", raw)
+		}
+		p.self[host] = true
+	}
+	return p, nil
+}
+
+// Check implements URLPolicy.
+func (p *HostPolicy) Check(ctx context.Context, u *url.URL) error {
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	addr, err := netip.ParseAddr(host)
+	isIP := err == nil
+	if isIP {
+		addr = addr.Unmap()
+	}
+
+	reason := ""
+	switch {
+	case p.self[host]:
+		reason = "points at this service"
+	case p.deny.match(host, addr, isIP):
+		reason = "denylisted"
+	case !p.allow.empty() && !p.allow.match(host, addr, isIP):
+		reason = "not allowlisted"
+	case !p.allowPrivate && isIP && !publicAddr(addr):
+		reason = "non-public address"
+	case !p.allowPrivate && !isIP && (host == "localhost" || strings.HasSuffix(host, ".localhost")):
+		reason = "non-public address"
+	case !p.allowPrivate && !isIP && numericTLD(host):
+		// Forms like "2130706433" or "0x7f.1" are IPv4 addresses to most
+		// resolvers; refuse them rather than guess where they lead.
+		reason = "non-canonical ip address"
+	}
+	if reason == "" {
+		return nil
+	}
+	LoggerFrom(ctx).Info("destination refused by url policy", "host", host, "reason", reason)
+	return ErrBlockedURL
+}
+
+// ReadHostList reads host patterns, one per line. Blank lines and text after
+// "#" are ignored.
+func ReadHostList(r io.Reader) ([]string, error) {
+	var out []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out, sc.Err()
+}
+
+// cgnat is the shared address space (RFC 6598), not covered by netip's IsPrivate.
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports whether addr is a globally routable unicast address.
+func publicAddr(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !cgnat.Contains(addr)
+}
+
+// numericTLD reports whether the last label of host looks like a number,
+// which no real top-level domain does.
+func numericTLD(host string) bool {
+	label := host[strings.LastIndexByte(host, '.')+1:]
+	if label == "" {
+		return false
+	}
+	if strings.HasPrefix(label, "0x") {
+		return true
+	}
+	for _, r := range label {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// hostSet matches hosts against exact names, "*." wildcards and IP prefixes.
+type hostSet struct {
+	exact    map[string]bool
+	suffixes []string // ".example.com" for "*.example.com"
+	prefixes []netip.Prefix
+}
+
+func newHostSet(patterns []string) (hostSet, error) {
+	s := hostSet{exact: make(map[string]bool)}
+	for _, raw := range patterns {
+		pat := strings.ToLower(strings.TrimSpace(raw))
+		if pat == "" {
+			continue
+		}
+		if strings.Contains(pat, "/") {
+			pfx, err := netip.ParsePrefix(pat)
+			if err != nil {
+				return hostSet{}, fmt.Errorf("invalid pattern %q", raw)
+			}
+			s.prefixes = append(s.prefixes, pfx.Masked())
+			continue
+		}
+		wildcard := strings.HasPrefix(pat, "*.")
+		host, err := canonicalHost(strings.TrimPrefix(pat, "*."))
+		if err != nil || strings.Contains(host, "*") {
+			return hostSet{}, fmt.Errorf("invalid pattern %q", raw)
+		}
+		if wildcard {
+			s.suffixes = append(s.suffixes, "."+host)
+		} else {
+			s.exact[host] = true
+		}
+	}
+	return s, nil
+}
+
+func (s hostSet) empty() bool {
+	return len(s.exact) == 0 && len(s.suffixes) == 0 && len(s.prefixes) == 0
+}
+
+func (s hostSet) match(host string, addr netip.Addr, isIP bool) bool {
+	if s.exact[host] {
+		return true
+	}
+	if isIP {
+		for _, p := range s.prefixes {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, suf := range s.suffixes {
+		if strings.HasSuffix(host, suf) {
+			return true
+		}
+	}
+	return false
+}
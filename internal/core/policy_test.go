@@ -0,0 +1,83 @@
+package core
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHostPolicy_Check(t *testing.T) {
+	deny, err := ReadHostList(strings.NewReader(`
+# phishing
+evil.example
+*.bad.example   # every subdomain
+198.51.100.0/24
+`))
+	if err != nil {
+		t.Fatalf("read list: %v", err)
+	}
+	p, err := NewHostPolicy(HostPolicyOptions{Deny: deny, Self: []string{"https://Sho.rt"}})
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+	allowOnly, err := NewHostPolicy(HostPolicyOptions{Allow: []string{"*.corp.example", "10.0.0.0/8"}, AllowPrivate: true})
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+
+	cases := []struct {
+		p       *HostPolicy
+		url     string
+		blocked bool
+	}{
+		{p, "https://example.com/", false},
+		{p, "https://8.8.8.8/", false},
+		{p, "http://127.0.0.1/", true},
+		{p, "http://169.254.169.254/latest/meta-data", true},
+		{p, "http://10.1.2.3/", true},
+		{p, "http://192.168.0.1:8080/", true},
+		{p, "http://100.64.0.1/", true},
+		{p, "http://0.0.0.0/", true},
+		{p, "http://[::1]/", true},
+		{p, "http://[fe80::1]/", true},
+		{p, "http://[fd00::1]/", true},
+		{p, "http://[::ffff:127.0.0.1]/", true},
+		{p, "http://localhost/", true},
+		{p, "http://api.localhost/", true},
+		{p, "http://2130706433/", true},
+		{p, "http://0x7f.1/", true},
+		{p, "https://sho.rt/abc", true},
+		{p, "https://evil.example/", true},
+		{p, "https://www.evil.example/", false}, // exact pattern only
+		{p, "https://x.bad.example/", true},
+		{p, "https://bad.example/", false}, // wildcard excludes the apex
+		{p, "http://198.51.100.7/", true},
+		{allowOnly, "https://git.corp.example/", false},
+		{allowOnly, "https://corp.example/", true},
+		{allowOnly, "https://example.com/", true},
+		{allowOnly, "http://10.9.9.9/", false},
+		{allowOnly, "http://localhost/", true},
+	}
+	for _, tc := range cases {
+		u, err := url.Parse(tc.url)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.url, err)
+		}
+		err = tc.p.Check(context.Background(), u)
+		if tc.blocked && err != ErrBlockedURL {
+			t.Errorf("%s: expected ErrBlockedURL, got %v", tc.url, err)
+		}
+		if !tc.blocked && err != nil {
+			t.Errorf("%s: expected allowed, got %v", tc.url, err)
+		}
+	}
+}
+
+func TestNewHostPolicy_RejectsBadPatterns(t *testing.T) {
+	for _, pat := range []string{"10.0.0.0/33", "a*.example", "exa mple.com"} {
+		if _, err := NewHostPolicy(HostPolicyOptions{Deny: []string{pat}}); err == nil {
+			t.Errorf("pattern %q: expected error", pat)
+		}
+	}
+}
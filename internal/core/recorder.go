@@ -0,0 +1,233 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultQueueSize     = 4096
+	defaultBatchSize     = 256
+	defaultFlushInterval = 500 * time.Millisecond
+	flushWriteTimeout    = 5 * time.Second
+)
+
+// RecorderOptions tunes the batching hit recorder. Zero values use defaults.
+type RecorderOptions struct {
+	QueueSize     int           // bounded queue capacity (default 4096)
+	BatchSize     int           // flush after this many buffered events (default 256)
+	FlushInterval time.Duration // flush at least this often (default 500ms)
+	// EnqueueTimeout applies backpressure: when the queue is full, Record waits
+	// up to this long for room before dropping. Zero drops immediately.
+	EnqueueTimeout time.Duration
+}
+
+// RecorderStats is a point-in-time snapshot of recorder counters.
+type RecorderStats struct {
+	Enqueued uint64 `json:"enqueued"` // events accepted into the queue
+	Dropped  uint64 `json:"dropped"`  // events rejected because the queue was full or closed
+	Blocked  uint64 `json:"blocked"`  // Record calls that had to wait for queue room
+	Flushed  uint64 `json:"flushed"`  // events written to the store
+	Failed   uint64 `json:"failed"`   // events lost to store errors
+	Batches  uint64 `json:"batches"`  // successful store writes
+	QueueLen int    `json:"queue_len"`
+}
+
+// Recorder buffers click events in a bounded queue and writes them to the
+// store in batches from a single goroutine, so redirect traffic never fans out
+// into one write per request.
+type Recorder struct {
+	store Store
+	opts  RecorderOptions
+
+	queue    chan ClickEvent
+	flushReq chan chan error
+	quit     chan struct{}
+	done     chan struct{}
+
+	mu     sync.RWMutex // guards closed against in-flight Record calls
+	closed bool
+
+	enqueued, dropped, blocked atomic.Uint64
+	flushed, failed, batches   atomic.Uint64
+}
+
+// NewRecorder starts a recorder writing to store.
+// Callers must Close it on shutdown to flush pending events.
+func NewRecorder(store Store, opts RecorderOptions) *Recorder {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultQueueSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	r := &Recorder{
+		store:    store,
+		opts:     opts,
+		queue:    make(chan ClickEvent, opts.QueueSize),
+		flushReq: make(chan chan error),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record enqueues ev without blocking the caller beyond EnqueueTimeout.
+// It reports whether the event was accepted.
+func (r *Recorder) Record(ev ClickEvent) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		r.dropped.Add(1)
+		return false
+	}
+	select {
+	case r.queue <- ev:
+		r.enqueued.Add(1)
+		return true
+	default:
+	}
+	if r.opts.EnqueueTimeout <= 0 {
+		r.dropped.Add(1)
+		return false
+	}
+	r.blocked.Add(1)
+	t := time.NewTimer(r.opts.EnqueueTimeout)
+	defer t.Stop()
+	select {
+	case r.queue <- ev:
+		r.enqueued.Add(1)
+		return true
+	case <-t.C:
+		r.dropped.Add(1)
+		return false
+	}
+}
+
+// Flush writes every event queued before the call and waits for the result.
+func (r *Recorder) Flush(ctx context.Context) error {
+	reply := make(chan error, 1)
+	select {
+	case r.flushReq <- reply:
+	case <-r.done:
+		return nil // already closed; everything was flushed on the way out
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting events, flushes what is pending and stops the worker.
+// It is safe to call more than once.
+func (r *Recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.quit)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of the recorder counters.
+func (r *Recorder) Stats() RecorderStats {
+	return RecorderStats{
+		Enqueued: r.enqueued.Load(),
+		Dropped:  r.dropped.Load(),
+		Blocked:  r.blocked.Load(),
+		Flushed:  r.flushed.Load(),
+		Failed:   r.failed.Load(),
+		Batches:  r.batches.Load(),
+		QueueLen: len(r.queue),
+	}
+}
+
+// ---- worker ----
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.opts.FlushInterval)
+	defer ticker.Stop()
+
+	buf := make([]ClickEvent, 0, r.opts.BatchSize)
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+		err := r.write(buf)
+		buf = buf[:0]
+		return err
+	}
+	// drain moves everything currently queued into buf, flushing full batches.
+	drain := func() error {
+		var firstErr error
+		for {
+			select {
+			case ev := <-r.queue:
+				buf = append(buf, ev)
+				if len(buf) >= r.opts.BatchSize {
+					if err := flush(); err != nil && firstErr == nil {
+						firstErr = err
+					}
+				}
+			default:
+				if err := flush(); err != nil && firstErr == nil {
+					firstErr = err
+				}
+				return firstErr
+			}
+		}
+	}
+
+	for {
+		select {
+		case ev := <-r.queue:
+			buf = append(buf, ev)
+			if len(buf) >= r.opts.BatchSize {
+				_ = flush()
+			}
+		case <-ticker.C:
+			_ = flush()
+		case reply := <-r.flushReq:
+			reply <- drain()
+		case <-r.quit:
+			// Record can no longer enqueue (closed is set under the write lock),
+			// so one drain empties the queue for good.
+			_ = drain()
+			return
+		}
+	}
+}
+
+func (r *Recorder) write(batch []ClickEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), flushWriteTimeout)
+	defer cancel()
+	n := uint64(len(batch))
+	if err := r.store.RecordClicks(ctx, batch); err != nil {
+		r.failed.Add(n)
+		slog.Error("click events dropped", "count", n, "error", err)
+		return err
+	}
+	r.flushed.Add(n)
+	r.batches.Add(1)
+	return nil
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchStore records RecordClicks batches; other Store methods are unused.
+type batchStore struct {
+	Store
+	mu      sync.Mutex
+	batches [][]ClickEvent
+	block   chan struct{}
+}
+
+func (s *batchStore) RecordClicks(_ context.Context, evs []ClickEvent) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]ClickEvent(nil), evs...))
+	return nil
+}
+
+func (s *batchStore) total() (events, batches int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.batches {
+		events += len(b)
+	}
+	return events, len(s.batches)
+}
+
+func TestRecorder_BatchesBySize(t *testing.T) {
+	st := &batchStore{}
+	r := NewRecorder(st, RecorderOptions{BatchSize: 10, FlushInterval: time.Hour})
+	for i := 0; i < 25; i++ {
+		if !r.Record(ClickEvent{Code: "abc"}) {
+			t.Fatalf("record %d rejected", i)
+		}
+	}
+	if err := r.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	events, batches := st.total()
+	if events != 25 || batches != 3 {
+		t.Fatalf("expected 25 events in 3 batches, got %d in %d", events, batches)
+	}
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestRecorder_FlushesOnInterval(t *testing.T) {
+	st := &batchStore{}
+	r := NewRecorder(st, RecorderOptions{BatchSize: 1000, FlushInterval: 20 * time.Millisecond})
+	defer r.Close(context.Background())
+
+	r.Record(ClickEvent{Code: "abc"})
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if n, _ := st.total(); n == 1 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("event was not flushed on interval")
+}
+
+func TestRecorder_DropsWhenFullAndFlushesOnClose(t *testing.T) {
+	st := &batchStore{block: make(chan struct{})}
+	r := NewRecorder(st, RecorderOptions{QueueSize: 2, BatchSize: 1, FlushInterval: time.Hour})
+
+	// The worker picks up the first event and blocks in the store; two more
+	// fill the queue, and everything after that is dropped.
+	r.Record(ClickEvent{Code: "abc"})
+	deadline := time.Now().Add(time.Second)
+	for len(r.queue) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 5; i++ {
+		r.Record(ClickEvent{Code: "abc"})
+	}
+	stats := r.Stats()
+	if stats.Enqueued != 3 || stats.Dropped != 3 {
+		t.Fatalf("expected 3 enqueued / 3 dropped, got %+v", stats)
+	}
+
+	close(st.block)
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if n, _ := st.total(); n != 3 {
+		t.Fatalf("expected 3 events flushed on close, got %d", n)
+	}
+	if r.Record(ClickEvent{Code: "abc"}) {
+		t.Fatal("record after close should be rejected")
+	}
+}
@@ -2,6 +2,8 @@ package core
 
 import (
 	"context"
+	"log/slog"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
@@ -17,59 +19,176 @@ const (
 
 var aliasRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
 
+// reservedAliases collide with fixed routes under "/" or "/api/".
+var reservedAliases = map[string]bool{
+	"api":     true,
+	"health":  true,
+	"keys":    true,
+	"links":   true,
+	"metrics": true,
+	"shorten": true,
+}
+
+// Options tunes optional Service behavior. The zero value is usable.
+type Options struct {
+	// IPHashSalt is mixed into client IP hashes stored with click events.
+	// When empty, a random per-process salt is used (hashes then differ across restarts).
+	IPHashSalt string
+	// Recorder, when set, receives click events asynchronously instead of
+	// RecordClick writing them to the store inline.
+	Recorder *Recorder
+	// PurgeGrace keeps expired links (still answering 410) for this long
+	// before CleanupExpired removes them.
+	PurgeGrace time.Duration
+	// PurgeArchive makes CleanupExpired soft-delete (archive) expired links
+	// instead of deleting them.
+	PurgeArchive bool
+	// Keys stores API keys; nil leaves only AdminKey usable.
+	Keys KeyStore
+	// AdminKey is a bootstrap admin secret accepted in addition to stored keys.
+	AdminKey string
+	// RequireAuth rejects anonymous Shorten calls.
+	RequireAuth bool
+	// Cache, when set, serves Resolve lookups from memory. The service
+	// invalidates it on its own writes.
+	Cache *Cache
+	// Dedupe makes Shorten return the caller's existing live link to the same
+	// destination instead of creating a new one. Requires a DedupeStore.
+	Dedupe bool
+	// Normalize configures tracking-parameter stripping and query sorting
+	// applied when canonicalizing destination URLs.
+	Normalize NormalizeOptions
+	// Policy, when set, vets every destination after normalization (see
+	// HostPolicy). Nil accepts any http(s) URL.
+	Policy URLPolicy
+	// Threats, when set, refuses destinations on a threat list at creation
+	// and lets redirects detect flagged links (see Service.Threat).
+	Threats ThreatMatcher
+	// MaxTTL, when positive, caps how far away a link's expiry may be; links
+	// created without one expire after MaxTTL.
+	MaxTTL time.Duration
+	// AnonymousTTL, when positive, is the lifetime of anonymous links
+	// created without ttl or expires_at.
+	AnonymousTTL time.Duration
+	// Now is the clock for expiry and go-live checks (nil = time.Now).
+	Now func() time.Time
+}
+
 // Service implements the business logic for creating and resolving short URLs.
 type Service struct {
 	store   Store
 	gen     CodeGenerator
 	nowFunc func() time.Time
+	ipSalt  []byte
+	rec     *Recorder
+	grace   time.Duration
+	archive bool
+	cache   *Cache
+	norm    normalizer
+	policy  URLPolicy
+	threats ThreatMatcher
+	lister  ListStore   // nil = store cannot list
+	stats   StatsStore  // nil = store cannot aggregate clicks
+	dedupe  DedupeStore // nil = dedupe off
+
+	hitLimit HitLimitStore // nil = store cannot cap hits
+	batch    BatchStore    // nil = batches are created link by link
+	maxTTL   time.Duration
+	anonTTL  time.Duration
+
+	keys        KeyStore
+	adminKey    string
+	requireAuth bool
 }
 
-func NewService(store Store, gen CodeGenerator) *Service {
+func NewService(store Store, gen CodeGenerator, opts Options) *Service {
+	var dedupe DedupeStore
+	if opts.Dedupe {
+		var ok bool
+		if dedupe, ok = store.(DedupeStore); !ok {
+			slog.Warn("dedupe requested but the store cannot look links up by URL; disabled")
+		}
+	}
+	lister, _ := store.(ListStore)
+	stats, _ := store.(StatsStore)
+	hitLimit, _ := store.(HitLimitStore)
+	batch, _ := store.(BatchStore)
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
 	return &Service{
 		store:   store,
 		gen:     gen,
-		nowFunc: time.Now,
+		nowFunc: now,
+		ipSalt:  ipSalt(opts.IPHashSalt),
+		rec:     opts.Recorder,
+		grace:   opts.PurgeGrace,
+		archive: opts.PurgeArchive,
+		cache:   opts.Cache,
+		norm:    newNormalizer(opts.Normalize),
+		policy:  opts.Policy,
+		threats: opts.Threats,
+		lister:  lister,
+		stats:   stats,
+		dedupe:  dedupe,
+
+		hitLimit: hitLimit,
+		batch:    batch,
+		maxTTL:   opts.MaxTTL,
+		anonTTL:  opts.AnonymousTTL,
+
+		keys:        opts.Keys,
+		adminKey:    opts.AdminKey,
+		requireAuth: opts.RequireAuth,
 	}
 }
 
 // Shorten validates input, optionally accepts a custom alias, or generates one.
-// It returns the created record (without guaranteeing Hits is updated concurrently).
+// The caller's API key (see WithPrincipal) becomes the owner of the link.
+// It returns the created record (without guaranteeing Hits is updated concurrently),
+// or the caller's existing link when dedupe applies (see ShortenOrReuse).
 func (s *Service) Shorten(ctx context.Context, in CreateRequest) (*URL, error) {
-	longURL, err := normalizeAndValidateURL(in.URL)
+	rec, _, err := s.ShortenOrReuse(ctx, in)
+	return rec, err
+}
+
+// ShortenOrReuse is Shorten that also reports whether an existing link was
+// returned instead of a new one. With Options.Dedupe, a request without a
+// custom alias, password, hit cap, ttl or ForceNew reuses the newest live link the same owner has
+// for the same normalized URL, redirect type and activation window.
+func (s *Service) ShortenOrReuse(ctx context.Context, in CreateRequest) (rec *URL, reused bool, err error) {
+	rec, err = s.findDuplicate(ctx, in)
+	if err != nil || rec != nil {
+		return rec, rec != nil, err
+	}
+	rec, err = s.create(ctx, in)
+	return rec, false, err
+}
+
+func (s *Service) create(ctx context.Context, in CreateRequest) (*URL, error) {
+	rec, err := s.newRecord(ctx, in)
 	if err != nil {
-		return nil, ErrInvalidURL
+		return nil, err
 	}
-	if in.ExpiresAt != nil && in.ExpiresAt.Before(s.nowFunc()) {
-		// Past expiry is not allowed.
-		return nil, ErrInvalidURL
+	if rec.PasswordHash, err = hashPassword(in.Password); err != nil {
+		return nil, err
 	}
-
-	var code string
-	if strings.TrimSpace(in.Custom) != "" {
-		if !validAlias(in.Custom) {
-			return nil, ErrInvalidCode
-		}
-		code = in.Custom
+	if rec.Code != "" {
 		// Single attempt for custom alias; surface conflict back to caller.
-		rec := &URL{
-			Code:      code,
-			LongURL:   longURL,
-			CreatedAt: s.nowFunc(),
-			ExpiresAt: in.ExpiresAt,
-			Hits:      0,
-		}
 		if err := s.store.Create(ctx, rec); err != nil {
 			if IsConflict(err) {
 				return nil, ErrConflict
 			}
 			return nil, err
 		}
+		s.invalidate(rec.Code)
 		return rec, nil
 	}
 
 	// Auto-generate codes; retry on rare collisions.
 	for i := 0; i < generateRetries; i++ {
-		code, err = s.gen.NewCode(ctx)
+		code, err := s.gen.NewCode(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -77,46 +196,160 @@ func (s *Service) Shorten(ctx context.Context, in CreateRequest) (*URL, error) {
 			// Defensive: if generator returns something invalid, retry.
 			continue
 		}
-		rec := &URL{
-			Code:      code,
-			LongURL:   longURL,
-			CreatedAt: s.nowFunc(),
-			ExpiresAt: in.ExpiresAt,
-			Hits:      0,
-		}
+		rec.Code = code
 		err = s.store.Create(ctx, rec)
 		if err == nil {
+			s.invalidate(code)
 			return rec, nil
 		}
 		if !IsConflict(err) {
 			return nil, err
 		}
+		LoggerFrom(ctx).Debug("generated code collided, retrying", "code", code, "attempt", i+1)
 	}
 	// Extremely unlikely after multiple retries.
 	return nil, ErrConflict
 }
 
-// Resolve returns the destination URL for a code if it exists and is not expired.
+// newRecord validates in and builds the record to insert. Code is the
+// custom alias, or empty when one must be generated. The password is checked
+// but not hashed: callers hash it once validation has passed.
+func (s *Service) newRecord(ctx context.Context, in CreateRequest) (*URL, error) {
+	var owner int64
+	p := PrincipalFrom(ctx)
+	if p != nil {
+		owner = p.KeyID
+	} else if s.requireAuth {
+		return nil, ErrUnauthorized
+	}
+	longURL, err := s.destination(ctx, in.URL)
+	if err != nil {
+		return nil, err
+	}
+	if in.ExpiresAt != nil && in.ExpiresAt.Before(s.nowFunc()) {
+		// Past expiry is not allowed.
+		return nil, ErrInvalidURL
+	}
+	expiresAt, err := s.expiry(in, p == nil)
+	if err != nil {
+		return nil, err
+	}
+	if !validWindow(in.StartsAt, expiresAt) {
+		return nil, ErrInvalidWindow
+	}
+	if !ValidRedirectType(in.RedirectType) {
+		return nil, ErrInvalidRedirect
+	}
+	if in.MaxHits < 0 {
+		return nil, ErrInvalidMaxHits
+	}
+	if in.MaxHits > 0 && s.hitLimit == nil {
+		return nil, ErrUnsupported
+	}
+	if len(in.Password) > maxPasswordLength {
+		return nil, ErrInvalidPassword
+	}
+	var code string
+	if strings.TrimSpace(in.Custom) != "" {
+		if !validAlias(in.Custom) || reservedAliases[strings.ToLower(in.Custom)] {
+			return nil, ErrInvalidCode
+		}
+		code = in.Custom
+	}
+	return &URL{
+		Code:      code,
+		LongURL:   longURL,
+		CreatedAt: s.nowFunc(),
+		ExpiresAt: expiresAt,
+		StartsAt:  in.StartsAt,
+		Hits:      0,
+		OwnerID:   owner,
+
+		RedirectType: in.RedirectType,
+		MaxHits:      in.MaxHits,
+	}, nil
+}
+
+// Now returns the current time on the service's clock. Handlers use it so
+// what they report about a link agrees with Resolve.
+func (s *Service) Now() time.Time {
+	return s.nowFunc()
+}
+
+// Resolve returns the destination URL for a code if it exists and is not
+// expired. Links that used up their MaxHits count as expired; the redirect
+// itself must still be claimed with UseHit.
+// Lookups go through the cache when one is configured; Hits may then be stale.
+// Links taken down with SetStatus fail with ErrDisabled or ErrQuarantined,
+// and links whose StartsAt lies ahead with ErrNotYetActive; the record is
+// still returned alongside those errors so callers can show the reason or
+// the go-live time.
 func (s *Service) Resolve(ctx context.Context, code string) (*URL, error) {
 	if !validAlias(code) {
 		return nil, ErrInvalidCode
 	}
-	rec, err := s.store.FindByCode(ctx, code)
+	rec, err := s.findCached(ctx, code)
 	if err != nil {
 		if IsNotFound(err) {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
+	switch rec.LinkStatus() {
+	case StatusDisabled:
+		return rec, ErrDisabled
+	case StatusQuarantined:
+		return rec, ErrQuarantined
+	}
+	if rec.StartsAt != nil && s.nowFunc().Before(*rec.StartsAt) {
+		return rec, ErrNotYetActive
+	}
 	// Pass the function, not its result.
-	if isExpired(rec, s.nowFunc) {
+	if isExpired(rec, s.nowFunc) || rec.Exhausted() {
 		return nil, ErrExpired
 	}
 	return rec, nil
 }
 
+// UseHit counts a redirect against rec's MaxHits and returns ErrExpired if
+// the cap was already reached. The check and increment are one atomic store
+// operation, so concurrent redirects never exceed the cap. Links without a
+// cap are not counted here.
+func (s *Service) UseHit(ctx context.Context, rec *URL) error {
+	if rec.MaxHits <= 0 {
+		return nil
+	}
+	if s.hitLimit == nil {
+		return ErrUnsupported
+	}
+	// Capped links are never cached, so there is no stale UsedHits to drop.
+	ok, err := s.hitLimit.ConsumeHit(ctx, rec.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Threat reports whether rec's destination is currently on the threat list
+// (see Options.Threats). Redirect handlers call it on every resolve, since
+// the list may have changed since the link was created.
+func (s *Service) Threat(rec *URL) (threat string, flagged bool) {
+	if s.threats == nil {
+		return "", false
+	}
+	u, err := url.Parse(rec.LongURL)
+	if err != nil {
+		return "", false
+	}
+	return s.threats.Match(u)
+}
+
 // Metadata returns the record whether or not it is expired.
-// Callers can decide how to present expiry status.
+// Callers can decide how to present expiry status. The destination of a
+// password-protected link is blanked unless the caller owns the link.
 func (s *Service) Metadata(ctx context.Context, code string) (*URL, error) {
 	if !validAlias(code) {
 		return nil, ErrInvalidCode
@@ -128,6 +361,9 @@ func (s *Service) Metadata(ctx context.Context, code string) (*URL, error) {
 		}
 		return nil, err
 	}
+	if rec.Protected() && authorizeOwner(ctx, rec) != nil {
+		rec.LongURL = ""
+	}
 	return rec, nil
 }
 
@@ -140,13 +376,137 @@ func (s *Service) RecordHit(ctx context.Context, code string) error {
 	return s.store.IncrementHits(ctx, code)
 }
 
-// CleanupExpired purges expired links and returns the number of rows affected.
+// CleanupExpired deletes (or archives, see Options.PurgeArchive) links that
+// expired more than the grace period ago and returns the number of rows affected.
 func (s *Service) CleanupExpired(ctx context.Context) (int64, error) {
-	return s.store.PurgeExpired(ctx, s.nowFunc())
+	now := s.nowFunc()
+	cutoff := now.Add(-s.grace)
+	if s.archive {
+		return s.store.ArchiveExpired(ctx, cutoff, now)
+	}
+	return s.store.PurgeExpired(ctx, cutoff)
+}
+
+// CacheStats returns the resolve cache counters; ok is false when caching is disabled.
+func (s *Service) CacheStats() (st CacheStats, ok bool) {
+	if s.cache == nil {
+		return CacheStats{}, false
+	}
+	return s.cache.Stats(), true
 }
 
 // ---- helpers ----
 
+// findDuplicate returns the link ShortenOrReuse should hand back instead of
+// creating one, or nil. Invalid input is left for create to reject.
+func (s *Service) findDuplicate(ctx context.Context, in CreateRequest) (*URL, error) {
+	if s.dedupe == nil || in.ForceNew || strings.TrimSpace(in.Custom) != "" || in.Password != "" || in.MaxHits != 0 ||
+		strings.TrimSpace(in.TTL) != "" {
+		return nil, nil
+	}
+	var owner int64
+	p := PrincipalFrom(ctx)
+	if p != nil {
+		owner = p.KeyID
+	} else if s.requireAuth {
+		return nil, nil
+	}
+	longURL, err := s.norm.normalize(in.URL)
+	if err != nil || !ValidRedirectType(in.RedirectType) {
+		return nil, nil
+	}
+	rec, err := s.dedupe.FindByLongURL(ctx, LongURLQuery{
+		LongURL:      longURL,
+		OwnerID:      owner,
+		RedirectType: in.RedirectType,
+		Now:          s.nowFunc(),
+	})
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// Without an explicit expires_at, a link that expires only stands in for
+	// one the server would also have given an expiry (MaxTTL, AnonymousTTL);
+	// otherwise the new link would never expire.
+	serverExpiry := s.maxTTL > 0 || p == nil && s.anonTTL > 0
+	switch {
+	case in.ExpiresAt != nil:
+		if !sameTime(rec.ExpiresAt, in.ExpiresAt) {
+			return nil, nil
+		}
+	case serverExpiry:
+		if s.checkMaxTTL(rec.ExpiresAt) != nil {
+			return nil, nil
+		}
+	case rec.ExpiresAt != nil:
+		return nil, nil
+	}
+	if !sameTime(rec.StartsAt, in.StartsAt) {
+		return nil, nil
+	}
+	// The policy may have changed since the link was created.
+	if err := s.checkPolicy(ctx, longURL); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// validWindow reports whether a link going live at start (if set) does so
+// before it expires (if set).
+func validWindow(start, expires *time.Time) bool {
+	return start == nil || expires == nil || start.Before(*expires)
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+// findCached is FindByCode behind the cache (if any), including negative
+// caching of unknown codes.
+func (s *Service) findCached(ctx context.Context, code string) (*URL, error) {
+	if s.cache == nil {
+		return s.store.FindByCode(ctx, code)
+	}
+	rec, found, gen := s.cache.get(code)
+	if found {
+		if rec == nil {
+			return nil, ErrNotFound
+		}
+		return rec, nil
+	}
+	rec, err := s.store.FindByCode(ctx, code)
+	switch {
+	case err == nil:
+		s.cache.put(rec, gen)
+	case IsNotFound(err):
+		s.cache.putMissing(code, gen)
+	}
+	return rec, err
+}
+
+// invalidate drops code from the cache after a write.
+func (s *Service) invalidate(code string) {
+	if s.cache != nil {
+		s.cache.Invalidate(code)
+	}
+}
+
+// ValidRedirectType reports whether t is an accepted per-link redirect
+// status; 0 (server default) is valid.
+func ValidRedirectType(t int) bool {
+	switch t {
+	case 0, http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
 func validAlias(a string) bool {
 	if len(a) < minAliasLength || len(a) > maxAliasLength {
 		return false
@@ -154,30 +514,44 @@ func validAlias(a string) bool {
 	return aliasRe.MatchString(a)
 }
 
-func isExpired(u *URL, now func() time.Time) bool {
-	if u == nil || u.ExpiresAt == nil {
-		return false
+// destination canonicalizes a requested long URL and vets it against the
+// URL policy.
+func (s *Service) destination(ctx context.Context, raw string) (string, error) {
+	longURL, err := s.norm.normalize(raw)
+	if err != nil {
+		return "", ErrInvalidURL
 	}
-	return now().After(*u.ExpiresAt)
+	if err := s.checkPolicy(ctx, longURL); err != nil {
+		return "", err
+	}
+	return longURL, nil
 }
 
-func normalizeAndValidateURL(raw string) (string, error) {
-	raw = strings.TrimSpace(raw)
-	if raw == "" || len(raw) > maxURLLength {
-		return "", ErrInvalidURL
+func (s *Service) checkPolicy(ctx context.Context, longURL string) error {
+	if s.policy == nil && s.threats == nil {
+		return nil
 	}
-	parsed, err := url.Parse(raw)
+	u, err := url.Parse(longURL)
 	if err != nil {
-		return "", ErrInvalidURL
+		return ErrInvalidURL
 	}
-	// Require explicit http/https scheme and non-empty host.
-	if parsed.Scheme != "http" && parsed.Scheme != "https" {
-		return "", ErrInvalidURL
+	if s.policy != nil {
+		if err := s.policy.Check(ctx, u); err != nil {
+			return err
+		}
 	}
-	if parsed.Host == "" {
-		return "", ErrInvalidURL
+	if s.threats != nil {
+		if threat, ok := s.threats.Match(u); ok {
+			LoggerFrom(ctx).Warn("destination on threat list", "host", u.Hostname(), "threat", threat)
+			return ErrBlockedURL
+		}
+	}
+	return nil
+}
+
+func isExpired(u *URL, now func() time.Time) bool {
+	if u == nil || u.ExpiresAt == nil {
+		return false
 	}
-	// Normalize: strip default ports and unnecessary whitespace (already trimmed).
-	// Keep as-is otherwise to avoid surprising the user.
-	return parsed.String(), nil
+	return now().After(*u.ExpiresAt)
 }
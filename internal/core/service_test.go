@@ -0,0 +1,171 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"urlshorty/internal/core"
+	"urlshorty/internal/id"
+	"urlshorty/internal/store/memory"
+)
+
+func openStore(t *testing.T) *memory.Store {
+	t.Helper()
+	return memory.New()
+}
+
+func createExpired(t *testing.T, st core.Store, code string, ago time.Duration) {
+	t.Helper()
+	exp := time.Now().Add(-ago).UTC()
+	err := st.Create(context.Background(), &core.URL{
+		Code:      code,
+		LongURL:   "https://example.com/" + code,
+		CreatedAt: exp.Add(-time.Hour),
+		ExpiresAt: &exp,
+	})
+	if err != nil {
+		t.Fatalf("create %s: %v", code, err)
+	}
+}
+
+func TestCleanupExpired_GraceAndArchive(t *testing.T) {
+	ctx := context.Background()
+	st := openStore(t)
+	createExpired(t, st, "recent", time.Minute)
+	createExpired(t, st, "old-one", 2*time.Hour)
+
+	// Grace keeps the recently expired link around.
+	svc := core.NewService(st, id.NewGenerator(7), core.Options{
+		PurgeGrace:   time.Hour,
+		PurgeArchive: true,
+	})
+	n, err := svc.CleanupExpired(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("archive with grace: n=%d err=%v", n, err)
+	}
+	rec, err := st.FindByCode(ctx, "old-one")
+	if err != nil || rec.ArchivedAt == nil {
+		t.Fatalf("expected archived record, got %+v err=%v", rec, err)
+	}
+	if _, err := svc.Resolve(ctx, "old-one"); !core.IsExpired(err) {
+		t.Fatalf("archived link should resolve as expired, got %v", err)
+	}
+	// Archiving is not repeated.
+	if n, _ := svc.CleanupExpired(ctx); n != 0 {
+		t.Fatalf("second archive run: expected 0, got %d", n)
+	}
+
+	// Hard delete without grace removes both.
+	svc = core.NewService(st, id.NewGenerator(7), core.Options{})
+	if n, err := svc.CleanupExpired(ctx); err != nil || n != 2 {
+		t.Fatalf("delete: n=%d err=%v", n, err)
+	}
+	if _, err := st.FindByCode(ctx, "recent"); !core.IsNotFound(err) {
+		t.Fatalf("expected deleted record, got %v", err)
+	}
+}
+
+func TestShorten_DedupeServerExpiry(t *testing.T) {
+	ctx := context.Background()
+	for name, opts := range map[string]core.Options{
+		"max_ttl":       {Dedupe: true, MaxTTL: time.Hour},
+		"anonymous_ttl": {Dedupe: true, AnonymousTTL: time.Hour},
+	} {
+		svc := core.NewService(openStore(t), id.NewGenerator(7), opts)
+		first, reused, err := svc.ShortenOrReuse(ctx, core.CreateRequest{URL: "https://example.com/a"})
+		if err != nil || reused || first.ExpiresAt == nil {
+			t.Fatalf("%s: first shorten: %+v reused=%v err=%v", name, first, reused, err)
+		}
+		again, reused, err := svc.ShortenOrReuse(ctx, core.CreateRequest{URL: "https://example.com/a"})
+		if err != nil || !reused || again.Code != first.Code {
+			t.Fatalf("%s: identical URL: got %+v reused=%v err=%v", name, again, reused, err)
+		}
+		// An explicit expiry still has to match.
+		exp := time.Now().Add(30 * time.Minute)
+		if rec, reused, err := svc.ShortenOrReuse(ctx, core.CreateRequest{URL: "https://example.com/a", ExpiresAt: &exp}); err != nil || reused {
+			t.Fatalf("%s: explicit expiry: %+v reused=%v err=%v", name, rec, reused, err)
+		}
+	}
+
+	// AnonymousTTL alone gives authenticated callers no expiry, so they do not
+	// get an expiring link back.
+	svc := core.NewService(openStore(t), id.NewGenerator(7), core.Options{Dedupe: true, AnonymousTTL: time.Hour})
+	alice := core.WithPrincipal(ctx, &core.Principal{KeyID: 7})
+	exp := time.Now().Add(30 * time.Minute)
+	expiring, _, err := svc.ShortenOrReuse(alice, core.CreateRequest{URL: "https://example.com/b", ExpiresAt: &exp})
+	if err != nil {
+		t.Fatalf("expiring link: %v", err)
+	}
+	if rec, reused, err := svc.ShortenOrReuse(alice, core.CreateRequest{URL: "https://example.com/b"}); err != nil || reused || rec.Code == expiring.Code {
+		t.Fatalf("authenticated, anonymous_ttl only: %+v reused=%v err=%v", rec, reused, err)
+	}
+
+	// Links older than MaxTTL (none, or a longer expiry) are not handed out.
+	st := openStore(t)
+	legacy, _, err := core.NewService(st, id.NewGenerator(7), core.Options{Dedupe: true}).
+		ShortenOrReuse(ctx, core.CreateRequest{URL: "https://example.com/legacy"})
+	if err != nil {
+		t.Fatalf("legacy link: %v", err)
+	}
+	svc = core.NewService(st, id.NewGenerator(7), core.Options{Dedupe: true, MaxTTL: time.Hour})
+	if rec, reused, err := svc.ShortenOrReuse(ctx, core.CreateRequest{URL: "https://example.com/legacy"}); err != nil || reused || rec.Code == legacy.Code {
+		t.Fatalf("link without expiry reused under MaxTTL: %+v reused=%v err=%v", rec, reused, err)
+	}
+}
+
+func TestShorten_Dedupe(t *testing.T) {
+	ctx := context.Background()
+	st := openStore(t)
+	svc := core.NewService(st, id.NewGenerator(7), core.Options{Dedupe: true})
+
+	first, reused, err := svc.ShortenOrReuse(ctx, core.CreateRequest{URL: "https://example.com/a"})
+	if err != nil || reused {
+		t.Fatalf("first shorten: reused=%v err=%v", reused, err)
+	}
+	again, reused, err := svc.ShortenOrReuse(ctx, core.CreateRequest{URL: "  https://example.com/a "})
+	if err != nil || !reused || again.Code != first.Code {
+		t.Fatalf("identical URL: got %+v reused=%v err=%v", again, reused, err)
+	}
+
+	// Each of these asks for something the existing link is not.
+	alice := core.WithPrincipal(ctx, &core.Principal{KeyID: 7})
+	exp := time.Now().Add(time.Hour)
+	for name, tc := range map[string]struct {
+		ctx context.Context
+		in  core.CreateRequest
+	}{
+		"force_new":     {ctx, core.CreateRequest{URL: "https://example.com/a", ForceNew: true}},
+		"custom":        {ctx, core.CreateRequest{URL: "https://example.com/a", Custom: "my-alias"}},
+		"other_owner":   {alice, core.CreateRequest{URL: "https://example.com/a"}},
+		"redirect_type": {ctx, core.CreateRequest{URL: "https://example.com/a", RedirectType: 302}},
+		"expiry":        {ctx, core.CreateRequest{URL: "https://example.com/a", ExpiresAt: &exp}},
+		"password":      {ctx, core.CreateRequest{URL: "https://example.com/a", Password: "pw"}},
+		"max_hits":      {ctx, core.CreateRequest{URL: "https://example.com/a", MaxHits: 1}},
+		"starts_at":     {ctx, core.CreateRequest{URL: "https://example.com/a", StartsAt: &exp}},
+	} {
+		rec, reused, err := svc.ShortenOrReuse(tc.ctx, tc.in)
+		if err != nil || reused || rec.Code == first.Code {
+			t.Fatalf("%s: expected a fresh code, got %+v reused=%v err=%v", name, rec, reused, err)
+		}
+	}
+
+	// Without a server-assigned expiry, a request without expires_at asks for
+	// a link that never expires, so an expiring one does not qualify.
+	if rec, reused, err := svc.ShortenOrReuse(ctx, core.CreateRequest{URL: "https://example.com/b"}); err != nil || reused {
+		t.Fatalf("fresh destination: %+v reused=%v err=%v", rec, reused, err)
+	}
+	expiring, _, err := svc.ShortenOrReuse(ctx, core.CreateRequest{URL: "https://example.com/c", ExpiresAt: &exp})
+	if err != nil {
+		t.Fatalf("expiring link: %v", err)
+	}
+	if rec, reused, err := svc.ShortenOrReuse(ctx, core.CreateRequest{URL: "https://example.com/c"}); err != nil || reused || rec.Code == expiring.Code || rec.ExpiresAt != nil {
+		t.Fatalf("no expires_at: expected a fresh code, got %+v reused=%v err=%v", rec, reused, err)
+	}
+
+	// Without the option every request creates a code.
+	plain := core.NewService(st, id.NewGenerator(7), core.Options{})
+	if rec, err := plain.Shorten(ctx, core.CreateRequest{URL: "https://example.com/a"}); err != nil || rec.Code == first.Code {
+		t.Fatalf("dedupe off: %+v err=%v", rec, err)
+	}
+}
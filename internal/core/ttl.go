@@ -0,0 +1,157 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TTLError explains why a requested lifetime is refused. It wraps
+// ErrInvalidTTL; its message is meant for the caller.
+type TTLError struct {
+	Reason string
+}
+
+func (e *TTLError) Error() string { return "invalid ttl: " + e.Reason }
+
+func (e *TTLError) Unwrap() error { return ErrInvalidTTL }
+
+func ttlError(format string, args ...any) error {
+	return &TTLError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// isoDurationRe matches ISO-8601 durations with weeks, days and a time part.
+// Years and months have no fixed length and are refused.
+var isoDurationRe = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// ParseTTL parses a Go duration ("72h", "90m") or an ISO-8601 duration
+// ("P7D", "PT12H", "P1W"). The result must be positive.
+func ParseTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ttlError("empty duration")
+	}
+	var d time.Duration
+	var err error
+	if up := strings.ToUpper(s); strings.HasPrefix(up, "P") {
+		d, err = parseISODuration(up)
+	} else if d, err = time.ParseDuration(s); err != nil {
+		err = ttlError("cannot parse %q; use a Go duration like \"72h\" or an ISO-8601 one like \"P7D\"", s)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, ttlError("%q is not a positive duration", s)
+	}
+	return d, nil
+}
+
+func parseISODuration(s string) (time.Duration, error) {
+	m := isoDurationRe.FindStringSubmatch(s)
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		if strings.ContainsAny(strings.SplitN(s, "T", 2)[0], "YM") {
+			return 0, ttlError("%q uses years or months, which have no fixed length; use days (e.g. \"P30D\")", s)
+		}
+		return 0, ttlError("cannot parse %q as an ISO-8601 duration", s)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute}
+	var d time.Duration
+	add := func(part time.Duration) bool {
+		if part < 0 || part > maxDuration-d {
+			return false
+		}
+		d += part
+		return true
+	}
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(m[i+1], 10, 64)
+		if err != nil || n > int64(maxDuration/unit) || !add(time.Duration(n)*unit) {
+			return 0, ttlError("%q is too long", s)
+		}
+	}
+	if m[5] != "" {
+		sec, err := strconv.ParseFloat(m[5], 64)
+		if err != nil || sec >= maxDuration.Seconds() || !add(time.Duration(sec*float64(time.Second))) {
+			return 0, ttlError("%q is too long", s)
+		}
+	}
+	return d, nil
+}
+
+const maxDuration = time.Duration(1<<63 - 1)
+
+// formatTTL renders d for error messages: whole days as "30 days", anything
+// else in Go syntax without zero units ("1h30m").
+func formatTTL(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d%day == 0 {
+		if n := d / day; n != 1 {
+			return fmt.Sprintf("%d days", n)
+		}
+		return "1 day"
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// expiry turns the ttl or expires_at of a create request into an absolute
+// expiry, applying Options.AnonymousTTL and Options.MaxTTL.
+func (s *Service) expiry(in CreateRequest, anonymous bool) (*time.Time, error) {
+	now := s.nowFunc()
+	if strings.TrimSpace(in.TTL) != "" {
+		if in.ExpiresAt != nil {
+			return nil, ttlError("set either ttl or expires_at, not both")
+		}
+		d, err := ParseTTL(in.TTL)
+		if err != nil {
+			return nil, err
+		}
+		if s.maxTTL > 0 && d > s.maxTTL {
+			return nil, ttlError("%s exceeds the maximum of %s", formatTTL(d), formatTTL(s.maxTTL))
+		}
+		exp := now.Add(d).UTC()
+		return &exp, nil
+	}
+	if in.ExpiresAt != nil {
+		if err := s.checkMaxTTL(in.ExpiresAt); err != nil {
+			return nil, err
+		}
+		return in.ExpiresAt, nil
+	}
+	d := s.maxTTL
+	if anonymous && s.anonTTL > 0 && (d == 0 || s.anonTTL < d) {
+		d = s.anonTTL
+	}
+	if d == 0 {
+		return nil, nil
+	}
+	exp := now.Add(d).UTC()
+	return &exp, nil
+}
+
+// checkMaxTTL refuses an expiry further away than Options.MaxTTL, or none at
+// all when a maximum is set.
+func (s *Service) checkMaxTTL(expiresAt *time.Time) error {
+	if s.maxTTL <= 0 {
+		return nil
+	}
+	if expiresAt == nil {
+		return ttlError("links must expire within %s", formatTTL(s.maxTTL))
+	}
+	if expiresAt.Sub(s.nowFunc()) > s.maxTTL {
+		return ttlError("expires_at is more than the maximum of %s away", formatTTL(s.maxTTL))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshorty/internal/core"
+	"urlshorty/internal/id"
+)
+
+func TestParseTTL(t *testing.T) {
+	valid := map[string]time.Duration{
+		"72h":      72 * time.Hour,
+		"1h30m":    90 * time.Minute,
+		" 90s ":    90 * time.Second,
+		"P7D":      7 * 24 * time.Hour,
+		"p1w":      7 * 24 * time.Hour,
+		"PT12H":    12 * time.Hour,
+		"P1DT2H":   26 * time.Hour,
+		"PT1M30S":  90 * time.Second,
+		"PT0.5S":   500 * time.Millisecond,
+		"P1W2DT3H": 9*24*time.Hour + 3*time.Hour,
+	}
+	for in, want := range valid {
+		if got, err := core.ParseTTL(in); err != nil || got != want {
+			t.Errorf("ParseTTL(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+
+	invalid := map[string]string{
+		"":                       "empty",
+		"3 days":                 "cannot parse",
+		"-1h":                    "not a positive",
+		"0s":                     "not a positive",
+		"PT0S":                   "not a positive",
+		"P":                      "cannot parse",
+		"P1DT":                   "cannot parse",
+		"P1M":                    "years or months",
+		"P1Y2D":                  "years or months",
+		"P99999999999999999999D": "too long",
+		"P300000W":               "too long",
+	}
+	for in, msg := range invalid {
+		_, err := core.ParseTTL(in)
+		if !errors.Is(err, core.ErrInvalidTTL) || !strings.Contains(err.Error(), msg) {
+			t.Errorf("ParseTTL(%q): got %v, want ErrInvalidTTL mentioning %q", in, err, msg)
+		}
+	}
+}
+
+func TestShorten_TTLPolicy(t *testing.T) {
+	ctx := context.Background()
+	svc := core.NewService(openStore(t), id.NewGenerator(7), core.Options{
+		AdminKey:     "admin",
+		MaxTTL:       30 * 24 * time.Hour,
+		AnonymousTTL: 24 * time.Hour,
+	})
+	owner := core.WithPrincipal(ctx, &core.Principal{Admin: true})
+	near := func(got *time.Time, d time.Duration) bool {
+		return got != nil && got.Sub(time.Now().Add(d)).Abs() < time.Minute
+	}
+
+	rec, err := svc.Shorten(ctx, core.CreateRequest{URL: "https://example.com/a", TTL: "P7D"})
+	if err != nil || !near(rec.ExpiresAt, 7*24*time.Hour) {
+		t.Fatalf("ttl: rec=%+v err=%v", rec, err)
+	}
+	if rec, err = svc.Shorten(ctx, core.CreateRequest{URL: "https://example.com/b"}); err != nil || !near(rec.ExpiresAt, 24*time.Hour) {
+		t.Fatalf("anonymous default: rec=%+v err=%v", rec, err)
+	}
+	if rec, err = svc.Shorten(owner, core.CreateRequest{URL: "https://example.com/c"}); err != nil || !near(rec.ExpiresAt, 30*24*time.Hour) {
+		t.Fatalf("authenticated default: rec=%+v err=%v", rec, err)
+	}
+
+	far := time.Now().Add(60 * 24 * time.Hour)
+	for name, in := range map[string]core.CreateRequest{
+		"31 days exceeds the maximum of 30 days": {URL: "https://example.com/d", TTL: "744h"},
+		"either ttl or expires_at":               {URL: "https://example.com/e", TTL: "1h", ExpiresAt: &far},
+		"more than the maximum of 30 days away":  {URL: "https://example.com/f", ExpiresAt: &far},
+	} {
+		_, err := svc.Shorten(owner, in)
+		if !errors.Is(err, core.ErrInvalidTTL) || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: got %v", name, err)
+		}
+	}
+
+	// Clearing the expiry would break the maximum.
+	if _, err := svc.Update(owner, rec.Code, core.UpdateRequest{ClearExpiresAt: true}); !errors.Is(err, core.ErrInvalidTTL) {
+		t.Fatalf("clear expiry: got %v", err)
+	}
+}
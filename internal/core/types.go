@@ -7,12 +7,68 @@ import (
 
 // URL represents a shortened link record.
 type URL struct {
-	ID        int64      `json:"id"`
-	Code      string     `json:"code"`
-	LongURL   string     `json:"url"`
-	CreatedAt time.Time  `json:"created_at"`
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
-	Hits      int64      `json:"hits"`
+	ID         int64      `json:"id"`
+	Code       string     `json:"code"`
+	LongURL    string     `json:"url"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	StartsAt   *time.Time `json:"starts_at,omitempty"` // Link does not redirect before this time
+	Hits       int64      `json:"hits"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"` // Set when the janitor soft-deleted an expired link
+	OwnerID    int64      `json:"owner_id,omitempty"`    // API key that created the link (0 = anonymous)
+	// RedirectType is the HTTP status used to redirect (301, 302, 307 or 308);
+	// 0 means the server default.
+	RedirectType int `json:"redirect_type,omitempty"`
+	// Status is StatusActive, StatusDisabled or StatusQuarantined (empty
+	// reads as active). Only admins change it, via Service.SetStatus.
+	Status          string     `json:"status,omitempty"`
+	StatusReason    string     `json:"status_reason,omitempty"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	// PasswordHash is the bcrypt hash of the link's password; empty for
+	// links that redirect without one.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// MaxHits caps the number of redirects (0 = unlimited). UsedHits counts
+	// redirects against the cap; unlike Hits it is updated synchronously by
+	// HitLimitStore.ConsumeHit, so it is exact.
+	MaxHits  int64 `json:"max_hits,omitempty"`
+	UsedHits int64 `json:"used_hits,omitempty"`
+}
+
+// Link statuses. Disabled links answer 410 Gone and quarantined links 451
+// Unavailable For Legal Reasons; both keep their record for auditing.
+const (
+	StatusActive      = "active"
+	StatusDisabled    = "disabled"
+	StatusQuarantined = "quarantined"
+)
+
+// LinkStatus returns u.Status, reporting the empty status as StatusActive.
+func (u *URL) LinkStatus() string {
+	if u.Status == "" {
+		return StatusActive
+	}
+	return u.Status
+}
+
+// Protected reports whether visitors must enter a password before being
+// redirected.
+func (u *URL) Protected() bool { return u.PasswordHash != "" }
+
+// Exhausted reports whether a capped link has used up its MaxHits.
+func (u *URL) Exhausted() bool { return u.MaxHits > 0 && u.UsedHits >= u.MaxHits }
+
+// RemainingHits returns how many redirects a capped link has left; ok is
+// false for links without a cap.
+func (u *URL) RemainingHits() (n int64, ok bool) {
+	if u.MaxHits <= 0 {
+		return 0, false
+	}
+	return max(u.MaxHits-u.UsedHits, 0), true
+}
+
+// ValidStatus reports whether s is a known link status.
+func ValidStatus(s string) bool {
+	return s == StatusActive || s == StatusDisabled || s == StatusQuarantined
 }
 
 // CreateRequest is the input to create/shorten a URL.
@@ -20,9 +76,57 @@ type CreateRequest struct {
 	URL       string     `json:"url"`
 	Custom    string     `json:"custom,omitempty"`     // Optional custom alias
 	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Optional UTC expiry
+	StartsAt  *time.Time `json:"starts_at,omitempty"`  // Optional go-live time (before ExpiresAt)
+	TTL       string     `json:"ttl,omitempty"`        // Optional lifetime ("72h", "P7D") instead of ExpiresAt
+	// RedirectType optionally picks the redirect status (301, 302, 307, 308).
+	RedirectType int `json:"redirect_type,omitempty"`
+	// ForceNew always creates a fresh code, even with dedupe enabled.
+	ForceNew bool `json:"force_new,omitempty"`
+	// Password optionally gates the redirect behind an unlock form. Only its
+	// hash is stored.
+	Password string `json:"password,omitempty"`
+	// MaxHits optionally makes the link expire after this many redirects.
+	MaxHits int64 `json:"max_hits,omitempty"`
+}
+
+// UpdateRequest describes a partial update of a link. Nil fields are left unchanged.
+type UpdateRequest struct {
+	URL            *string    // New destination
+	ExpiresAt      *time.Time // New expiry (must be in the future)
+	ClearExpiresAt bool       // Remove the expiry entirely (ignored if ExpiresAt is set)
+	StartsAt       *time.Time // New go-live time
+	ClearStartsAt  bool       // Make the link live immediately (ignored if StartsAt is set)
+	RedirectType   *int       // New redirect status (0 = back to the server default)
+}
+
+// ListQuery selects a page of links, newest first.
+type ListQuery struct {
+	BeforeID int64 // only return records with ID < BeforeID (0 = from the newest)
+	OwnerID  int64 // only return records owned by this key (0 = all owners)
+	Limit    int
 }
 
-// Store abstracts persistence for URL records.
+// LongURLQuery selects live links to one destination for dedupe.
+type LongURLQuery struct {
+	LongURL      string    // normalized destination
+	OwnerID      int64     // only links owned by this key (0 = anonymous links only)
+	RedirectType int       // only links with this redirect type
+	Now          time.Time // links expired at or before Now, archived, not active, password-protected or capped are skipped
+}
+
+// LinkPage is one page of a link listing.
+type LinkPage struct {
+	Links      []*URL `json:"links"`
+	NextCursor string `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+// Store is the storage contract every backend must satisfy: link CRUD,
+// expiry reaping and click recording. Optional capabilities live in the
+// smaller interfaces below (ListStore, StatsStore, DedupeStore,
+// HitLimitStore, BatchStore, KeyStore);
+// the Service reports ErrUnsupported (or disables the feature) when a store
+// lacks one. FullStore bundles them all, and storetest.Run checks any of
+// them a backend implements.
 type Store interface {
 	// Create inserts a new record. Must fail with ErrConflict if code is taken.
 	Create(ctx context.Context, u *URL) error
@@ -30,11 +134,131 @@ type Store interface {
 	FindByCode(ctx context.Context, code string) (*URL, error)
 	// IncrementHits increases the hits counter for a code (best-effort).
 	IncrementHits(ctx context.Context, code string) error
-	// PurgeExpired deletes or disables expired records and returns affected count.
+	// PurgeExpired deletes records that expired at or before now and returns affected count.
 	PurgeExpired(ctx context.Context, now time.Time) (int64, error)
+	// ArchiveExpired soft-deletes records that expired at or before cutoff by
+	// setting ArchivedAt to now (once), keeping the row and its clicks.
+	// Returns the newly archived count.
+	ArchiveExpired(ctx context.Context, cutoff, now time.Time) (int64, error)
+	// Update overwrites the mutable fields (LongURL, ExpiresAt, StartsAt,
+	// ArchivedAt, RedirectType and the Status fields) of the record with
+	// u.Code; PasswordHash and MaxHits are set at creation only.
+	// Must fail with ErrNotFound if the code does not exist.
+	Update(ctx context.Context, u *URL) error
+	// Delete removes the record for code and its click events.
+	// Must fail with ErrNotFound if the code does not exist.
+	Delete(ctx context.Context, code string) error
+	// RecordClicks stores a batch of click events and increments the hits counter
+	// of each code by its number of events, atomically. Events for codes that no
+	// longer exist are skipped.
+	RecordClicks(ctx context.Context, evs []ClickEvent) error
+}
+
+// ListStore is implemented by stores that can page through links
+// (GET /api/links).
+type ListStore interface {
+	// List returns up to q.Limit records ordered by descending ID.
+	List(ctx context.Context, q ListQuery) ([]*URL, error)
+}
+
+// StatsStore is implemented by stores that can aggregate recorded clicks
+// (GET /api/:code/stats).
+type StatsStore interface {
+	// ClickStats aggregates click events for a code within q's window.
+	// Series only contains non-empty buckets; callers fill gaps if needed.
+	ClickStats(ctx context.Context, code string, q StatsQuery) (*ClickStats, error)
+}
+
+// FullStore is a store with every optional capability. The bundled
+// backends (sqlite, postgres, memory) implement it.
+type FullStore interface {
+	Store
+	ListStore
+	StatsStore
+	DedupeStore
+	HitLimitStore
+	BatchStore
+	KeyStore
+}
+
+// DedupeStore is implemented by stores that can look links up by destination.
+// Service.Shorten uses it when Options.Dedupe is set.
+type DedupeStore interface {
+	// FindByLongURL returns the newest link matching q, or ErrNotFound.
+	FindByLongURL(ctx context.Context, q LongURLQuery) (*URL, error)
+}
+
+// HitLimitStore is implemented by stores that can enforce URL.MaxHits.
+// Without it, Shorten refuses links with a cap.
+type HitLimitStore interface {
+	// ConsumeHit atomically increments UsedHits of the record with code if it
+	// is still below MaxHits (or MaxHits is 0) and reports whether it did.
+	// It reports false when the cap is reached or the code does not exist.
+	ConsumeHit(ctx context.Context, code string) (bool, error)
+}
+
+// BatchStore is implemented by stores that can create many links in one
+// transaction. Service.ShortenBatch uses it; without it, batches are created
+// link by link and all-or-nothing batches are refused.
+type BatchStore interface {
+	// CreateBatch inserts recs in a single transaction and sets their IDs.
+	// Inserts whose code is taken are skipped and reported as ErrConflict at
+	// their index in errs; with atomic set, any conflict rolls the whole
+	// batch back instead. Other failures roll back and are returned as err.
+	CreateBatch(ctx context.Context, recs []*URL, atomic bool) (errs []error, err error)
 }
 
 // CodeGenerator creates collision-resistant short codes.
 type CodeGenerator interface {
 	NewCode(ctx context.Context) (string, error)
 }
+
+// ClickEvent is a single recorded redirect. Client details are reduced to
+// what analytics needs: the referrer host and a salted hash of the client IP.
+type ClickEvent struct {
+	Code      string    `json:"code"`
+	At        time.Time `json:"at"`
+	Referrer  string    `json:"referrer,omitempty"`   // Referrer host ("" for direct traffic)
+	UserAgent string    `json:"user_agent,omitempty"` // Raw User-Agent header (truncated)
+	IPHash    string    `json:"ip_hash,omitempty"`    // Salted SHA-256 of the client IP
+	Country   string    `json:"country,omitempty"`    // ISO country code; placeholder until GeoIP is wired
+}
+
+// StatsBucket is the granularity of a click time series.
+type StatsBucket string
+
+const (
+	BucketHour StatsBucket = "hour"
+	BucketDay  StatsBucket = "day"
+)
+
+// StatsQuery selects the window and granularity for click statistics.
+type StatsQuery struct {
+	Bucket StatsBucket
+	From   time.Time // inclusive
+	To     time.Time // exclusive
+	TopN   int       // number of top referrers to return
+}
+
+// BucketCount is the number of clicks in one time bucket.
+type BucketCount struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+// ReferrerCount is the number of clicks attributed to one referrer host.
+type ReferrerCount struct {
+	Referrer string `json:"referrer"`
+	Count    int64  `json:"count"`
+}
+
+// ClickStats is the aggregated analytics view for a code.
+type ClickStats struct {
+	Code         string          `json:"code"`
+	Bucket       StatsBucket     `json:"bucket"`
+	From         time.Time       `json:"from"`
+	To           time.Time       `json:"to"`
+	Total        int64           `json:"total"`
+	Series       []BucketCount   `json:"series"`
+	TopReferrers []ReferrerCount `json:"top_referrers"`
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"urlshorty/internal/core"
+)
+
+const (
+	defaultBulkMaxItems = 100
+
+	// bulkItemBytes budgets one item of the body: a URL at the 2048-byte
+	// limit plus the other fields, with room for JSON escaping.
+	bulkItemBytes = 4 << 10
+)
+
+// bulkBody is the POST /api/shorten/bulk payload.
+type bulkBody struct {
+	Items  []core.CreateRequest `json:"items"`
+	Atomic bool                 `json:"atomic"` // create all items or none
+}
+
+// ShortenBulk creates up to bulkMaxItems links in one store transaction and
+// answers with one result per item, in order. Each item costs one token of
+// the shorten rate limit.
+//
+// The response is 201 when every item succeeded and 207 when some failed.
+// An all-or-nothing batch that fails creates nothing and answers with the
+// status of its first failed item.
+func (h *Handlers) ShortenBulk(c *gin.Context) {
+	// Bound the body before decoding it; the item count is only known after.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(h.bulkMaxItems)*bulkItemBytes+1024)
+	var body bulkBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		h.metrics.shorten("invalid_body")
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			jsonError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		jsonError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if len(body.Items) == 0 || len(body.Items) > h.bulkMaxItems {
+		h.metrics.shorten("invalid_body")
+		jsonError(c, http.StatusBadRequest, fmt.Sprintf("items must hold 1 to %d requests", h.bulkMaxItems))
+		return
+	}
+	if h.shortenLimiter != nil && !h.shortenLimiter.AllowN(c.ClientIP(), len(body.Items)) {
+		h.metrics.rateLimited(c.FullPath())
+		jsonError(c, http.StatusTooManyRequests, "rate limited")
+		return
+	}
+	res, err := h.svc.ShortenBatch(c.Request.Context(), body.Items, body.Atomic)
+	if err != nil {
+		h.metrics.shorten(outcome(err))
+		status, msg := shortenError(err)
+		jsonError(c, status, msg)
+		return
+	}
+
+	status, failed := http.StatusCreated, 0
+	results := make([]gin.H, len(res))
+	for i, r := range res {
+		var item gin.H
+		switch {
+		case r.Err != nil:
+			h.metrics.shorten(outcome(r.Err))
+			itemStatus, msg := shortenError(r.Err)
+			item = gin.H{"status": itemStatus, "error": msg}
+			switch {
+			case !body.Atomic:
+				status = http.StatusMultiStatus
+			case status == http.StatusCreated && r.Err != core.ErrBatchAborted:
+				status = itemStatus
+			}
+			failed++
+		case r.Reused:
+			h.metrics.shorten("reused")
+			item = h.shortenView(r.URL)
+			item["status"] = http.StatusOK
+		default:
+			h.metrics.shorten("created")
+			item = h.shortenView(r.URL)
+			item["status"] = http.StatusCreated
+		}
+		item["index"] = i
+		results[i] = item
+	}
+	c.JSON(status, gin.H{
+		"atomic":    body.Atomic,
+		"succeeded": len(res) - failed,
+		"failed":    failed,
+		"results":   results,
+	})
+}
@@ -1,58 +1,134 @@
 package http
 
 import (
-	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"urlshorty/internal/core"
+	"urlshorty/internal/rate"
 )
 
 type Handlers struct {
 	svc     *core.Service
 	baseURL string
+	metrics *Metrics
+
+	defaultRedirect int // status for links without their own RedirectType
+
+	unlockKey     []byte        // signs unlock cookies of password-protected links
+	unlockTTL     time.Duration // lifetime of an unlock cookie
+	unlockLimiter *rate.Limiter // throttles password attempts per code and IP (nil = off)
+
+	scheduledPage     *template.Template // placeholder for links before starts_at
+	scheduledNotFound bool               // answer 404 instead of the placeholder
+
+	shortenLimiter *rate.Limiter // per-IP budget shared by single and bulk shorten (nil = off)
+	bulkMaxItems   int           // most items accepted by one bulk shorten
 }
 
+// permanentMaxAge bounds how long clients may cache a 301/308 redirect, so
+// a destination edit eventually reaches returning visitors.
+const permanentMaxAge = 24 * time.Hour
+
 func NewHandlers(svc *core.Service, baseURL string) *Handlers {
-	return &Handlers{svc: svc, baseURL: baseURL}
+	return &Handlers{
+		svc:             svc,
+		baseURL:         baseURL,
+		defaultRedirect: http.StatusMovedPermanently,
+		unlockKey:       unlockKey(""),
+		unlockTTL:       defaultUnlockTTL,
+		scheduledPage:   scheduledPage,
+		bulkMaxItems:    defaultBulkMaxItems,
+	}
 }
 
 // ---- endpoints ----
 
+// Health reports liveness plus resolve cache counters when caching is on.
 func (h *Handlers) Health(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"ok": true})
+	body := gin.H{"ok": true}
+	if st, ok := h.svc.CacheStats(); ok {
+		body["cache"] = st
+	}
+	c.JSON(http.StatusOK, body)
 }
 
 func (h *Handlers) Shorten(c *gin.Context) {
 	var in core.CreateRequest
 	if err := c.ShouldBindJSON(&in); err != nil {
+		h.metrics.shorten("invalid_body")
 		jsonError(c, http.StatusBadRequest, "invalid json body")
 		return
 	}
-	rec, err := h.svc.Shorten(c.Request.Context(), in)
+	rec, reused, err := h.svc.ShortenOrReuse(c.Request.Context(), in)
 	if err != nil {
-		switch err {
-		case core.ErrInvalidURL, core.ErrInvalidCode:
-			jsonError(c, http.StatusBadRequest, err.Error())
-		case core.ErrConflict:
-			jsonError(c, http.StatusConflict, err.Error())
-		default:
-			jsonError(c, http.StatusInternalServerError, "internal error")
-		}
+		h.metrics.shorten(outcome(err))
+		status, msg := shortenError(err)
+		jsonError(c, status, msg)
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{
+	status := http.StatusCreated
+	if reused {
+		h.metrics.shorten("reused")
+		status = http.StatusOK
+	} else {
+		h.metrics.shorten("created")
+	}
+	c.JSON(status, h.shortenView(rec))
+}
+
+// shortenError maps a Shorten error to a status and message. Bulk shorten
+// uses it per item.
+func shortenError(err error) (int, string) {
+	if errors.Is(err, core.ErrInvalidTTL) {
+		// The wrapped error says which policy the ttl broke.
+		return http.StatusBadRequest, err.Error()
+	}
+	switch err {
+	case core.ErrInvalidURL, core.ErrInvalidCode, core.ErrInvalidRedirect, core.ErrInvalidPassword, core.ErrInvalidMaxHits,
+		core.ErrInvalidWindow, core.ErrBatchPasswords:
+		return http.StatusBadRequest, err.Error()
+	case core.ErrBlockedURL:
+		return http.StatusUnprocessableEntity, err.Error()
+	case core.ErrConflict:
+		return http.StatusConflict, err.Error()
+	case core.ErrBatchAborted:
+		return http.StatusFailedDependency, err.Error()
+	case core.ErrUnsupported:
+		return http.StatusNotImplemented, err.Error()
+	case core.ErrUnauthorized:
+		return http.StatusUnauthorized, err.Error()
+	case core.ErrForbidden:
+		return http.StatusForbidden, err.Error()
+	default:
+		return http.StatusInternalServerError, "internal error"
+	}
+}
+
+// shortenView is the response body for a created (or reused) link.
+func (h *Handlers) shortenView(rec *core.URL) gin.H {
+	out := gin.H{
 		"code":      rec.Code,
 		"short_url": h.baseURL + "/" + rec.Code,
-	})
+	}
+	if rec.ExpiresAt != nil {
+		// Echoed because ttl and the server defaults compute it.
+		out["expires_at"] = rec.ExpiresAt.UTC()
+	}
+	return out
 }
 
 func (h *Handlers) Redirect(c *gin.Context) {
 	code := c.Param("code")
 	rec, err := h.svc.Resolve(c.Request.Context(), code)
 	if err != nil {
+		h.metrics.redirect(outcome(err))
 		switch err {
 		case core.ErrInvalidCode:
 			jsonError(c, http.StatusBadRequest, err.Error())
@@ -60,18 +136,54 @@ func (h *Handlers) Redirect(c *gin.Context) {
 			jsonError(c, http.StatusNotFound, "not found")
 		case core.ErrExpired:
 			jsonError(c, http.StatusGone, "link expired")
+		case core.ErrDisabled, core.ErrQuarantined:
+			renderUnavailable(c, rec)
+		case core.ErrNotYetActive:
+			h.renderScheduled(c, rec)
 		default:
 			jsonError(c, http.StatusInternalServerError, "internal error")
 		}
 		return
 	}
 
-	// Best-effort hit counting (async) with a proper context.
-	go func(code string) {
-		_ = h.svc.RecordHit(context.Background(), code)
-	}(code)
+	// Password-protected links need an unlock cookie (see Unlock).
+	if rec.Protected() && !h.unlocked(c, rec) {
+		h.metrics.redirect("locked")
+		renderUnlock(c, http.StatusOK, code, "")
+		return
+	}
+
+	// Destinations that landed on the threat list get a warning instead.
+	if threat, flagged := h.svc.Threat(rec); flagged {
+		h.metrics.redirect("flagged")
+		renderInterstitial(c, code, rec.LongURL, threat)
+		return
+	}
 
-	c.Redirect(http.StatusMovedPermanently, rec.LongURL)
+	// Capped links claim this redirect atomically; losing the race for the
+	// last use means the link is spent.
+	if err := h.svc.UseHit(c.Request.Context(), rec); err != nil {
+		h.metrics.redirect(outcome(err))
+		switch err {
+		case core.ErrExpired:
+			jsonError(c, http.StatusGone, "link expired")
+		default:
+			jsonError(c, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+
+	// Best-effort click recording; the service queues it for a batched write.
+	_ = h.svc.RecordClick(c.Request.Context(), code, core.ClickSource{
+		Referer:   c.Request.Referer(),
+		UserAgent: c.Request.UserAgent(),
+		ClientIP:  c.ClientIP(),
+	})
+
+	h.metrics.redirect("found")
+	status := h.redirectStatus(rec)
+	c.Header("Cache-Control", redirectCacheControl(status, rec))
+	c.Redirect(status, rec.LongURL)
 }
 
 func (h *Handlers) Metadata(c *gin.Context) {
@@ -88,23 +200,349 @@ func (h *Handlers) Metadata(c *gin.Context) {
 		}
 		return
 	}
-	expired := false
-	if rec.ExpiresAt != nil && time.Now().After(*rec.ExpiresAt) {
-		expired = true
+	c.JSON(http.StatusOK, h.linkView(rec))
+}
+
+// updateBody is the PATCH /api/:code payload. expires_at and starts_at may
+// be null to remove them, so they are decoded by hand.
+type updateBody struct {
+	URL          *string         `json:"url"`
+	ExpiresAt    json.RawMessage `json:"expires_at"`
+	StartsAt     json.RawMessage `json:"starts_at"`
+	RedirectType *int            `json:"redirect_type"`
+}
+
+// Update changes the destination and/or expiry of a link.
+func (h *Handlers) Update(c *gin.Context) {
+	var body updateBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		jsonError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	in := core.UpdateRequest{URL: body.URL, RedirectType: body.RedirectType}
+	var err error
+	if in.ExpiresAt, in.ClearExpiresAt, err = nullableTimeField(body.ExpiresAt); err != nil {
+		jsonError(c, http.StatusBadRequest, "invalid expires_at")
+		return
+	}
+	if in.StartsAt, in.ClearStartsAt, err = nullableTimeField(body.StartsAt); err != nil {
+		jsonError(c, http.StatusBadRequest, "invalid starts_at")
+		return
+	}
+	rec, err := h.svc.Update(c.Request.Context(), c.Param("code"), in)
+	if err != nil {
+		if errors.Is(err, core.ErrInvalidTTL) {
+			jsonError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		switch err {
+		case core.ErrInvalidURL, core.ErrInvalidCode, core.ErrInvalidRedirect, core.ErrInvalidWindow:
+			jsonError(c, http.StatusBadRequest, err.Error())
+		case core.ErrBlockedURL:
+			jsonError(c, http.StatusUnprocessableEntity, err.Error())
+		case core.ErrNotFound:
+			jsonError(c, http.StatusNotFound, "not found")
+		case core.ErrUnauthorized:
+			jsonError(c, http.StatusUnauthorized, err.Error())
+		case core.ErrForbidden:
+			jsonError(c, http.StatusForbidden, err.Error())
+		default:
+			jsonError(c, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, h.linkView(rec))
+}
+
+// Delete removes a link and its analytics.
+func (h *Handlers) Delete(c *gin.Context) {
+	if err := h.svc.Delete(c.Request.Context(), c.Param("code")); err != nil {
+		switch err {
+		case core.ErrInvalidCode:
+			jsonError(c, http.StatusBadRequest, err.Error())
+		case core.ErrNotFound:
+			jsonError(c, http.StatusNotFound, "not found")
+		case core.ErrUnauthorized:
+			jsonError(c, http.StatusUnauthorized, err.Error())
+		case core.ErrForbidden:
+			jsonError(c, http.StatusForbidden, err.Error())
+		default:
+			jsonError(c, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// statusBody is the PUT /api/:code/status payload.
+type statusBody struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// SetStatus disables, quarantines or reactivates a link (admin only).
+func (h *Handlers) SetStatus(c *gin.Context) {
+	var body statusBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		jsonError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	rec, err := h.svc.SetStatus(c.Request.Context(), c.Param("code"), body.Status, body.Reason)
+	if err != nil {
+		switch err {
+		case core.ErrInvalidCode, core.ErrInvalidStatus:
+			jsonError(c, http.StatusBadRequest, err.Error())
+		case core.ErrNotFound:
+			jsonError(c, http.StatusNotFound, "not found")
+		case core.ErrUnauthorized:
+			jsonError(c, http.StatusUnauthorized, err.Error())
+		case core.ErrForbidden:
+			jsonError(c, http.StatusForbidden, err.Error())
+		default:
+			jsonError(c, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, h.linkView(rec))
+}
+
+// List pages through links, newest first. Query: cursor, limit.
+func (h *Handlers) List(c *gin.Context) {
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			jsonError(c, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	page, err := h.svc.List(c.Request.Context(), c.Query("cursor"), limit)
+	if err != nil {
+		switch err {
+		case core.ErrInvalidCursor:
+			jsonError(c, http.StatusBadRequest, err.Error())
+		case core.ErrUnauthorized:
+			jsonError(c, http.StatusUnauthorized, err.Error())
+		case core.ErrForbidden:
+			jsonError(c, http.StatusForbidden, err.Error())
+		case core.ErrUnsupported:
+			jsonError(c, http.StatusNotImplemented, err.Error())
+		default:
+			jsonError(c, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+	links := make([]gin.H, 0, len(page.Links))
+	for _, rec := range page.Links {
+		links = append(links, h.linkView(rec))
 	}
 	c.JSON(http.StatusOK, gin.H{
+		"links":       links,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+// Stats returns click analytics for a code.
+// Query: bucket=hour|day, from/to (RFC3339), top (number of referrers).
+func (h *Handlers) Stats(c *gin.Context) {
+	code := c.Param("code")
+	q := core.StatsQuery{Bucket: core.StatsBucket(c.Query("bucket"))}
+	var err error
+	if q.From, err = parseTimeParam(c.Query("from")); err != nil {
+		jsonError(c, http.StatusBadRequest, "invalid from")
+		return
+	}
+	if q.To, err = parseTimeParam(c.Query("to")); err != nil {
+		jsonError(c, http.StatusBadRequest, "invalid to")
+		return
+	}
+	if top := c.Query("top"); top != "" {
+		if q.TopN, err = strconv.Atoi(top); err != nil {
+			jsonError(c, http.StatusBadRequest, "invalid top")
+			return
+		}
+	}
+	st, err := h.svc.Stats(c.Request.Context(), code, q)
+	if err != nil {
+		switch err {
+		case core.ErrInvalidCode, core.ErrInvalidStats:
+			jsonError(c, http.StatusBadRequest, err.Error())
+		case core.ErrNotFound:
+			jsonError(c, http.StatusNotFound, "not found")
+		case core.ErrUnauthorized:
+			jsonError(c, http.StatusUnauthorized, err.Error())
+		case core.ErrForbidden:
+			jsonError(c, http.StatusForbidden, err.Error())
+		case core.ErrUnsupported:
+			jsonError(c, http.StatusNotImplemented, err.Error())
+		default:
+			jsonError(c, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
+// CreateKey issues a new API key (admin only). Body: {"name": "...", "admin": false}.
+// The secret is only returned in this response.
+func (h *Handlers) CreateKey(c *gin.Context) {
+	var in struct {
+		Name  string `json:"name"`
+		Admin bool   `json:"admin"`
+	}
+	if err := c.ShouldBindJSON(&in); err != nil {
+		jsonError(c, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	secret, k, err := h.svc.CreateAPIKey(c.Request.Context(), in.Name, in.Admin)
+	if err != nil {
+		h.keyError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         k.ID,
+		"name":       k.Name,
+		"admin":      k.Admin,
+		"created_at": k.CreatedAt,
+		"key":        secret,
+	})
+}
+
+// ListKeys returns all API keys without their secrets (admin only).
+func (h *Handlers) ListKeys(c *gin.Context) {
+	keys, err := h.svc.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		h.keyError(c, err)
+		return
+	}
+	if keys == nil {
+		keys = []*core.APIKey{}
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// RevokeKey disables an API key (admin only).
+func (h *Handlers) RevokeKey(c *gin.Context) {
+	keyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || keyID <= 0 {
+		jsonError(c, http.StatusBadRequest, "invalid key id")
+		return
+	}
+	if err := h.svc.RevokeAPIKey(c.Request.Context(), keyID); err != nil {
+		h.keyError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ---- helpers ----
+
+func (h *Handlers) keyError(c *gin.Context, err error) {
+	switch err {
+	case core.ErrInvalidKeyName:
+		jsonError(c, http.StatusBadRequest, err.Error())
+	case core.ErrUnauthorized:
+		jsonError(c, http.StatusUnauthorized, err.Error())
+	case core.ErrForbidden:
+		jsonError(c, http.StatusForbidden, err.Error())
+	case core.ErrNotFound:
+		jsonError(c, http.StatusNotFound, "not found")
+	case core.ErrUnsupported:
+		jsonError(c, http.StatusNotImplemented, err.Error())
+	default:
+		jsonError(c, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func jsonError(c *gin.Context, status int, msg string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": msg})
+}
+
+// linkView is the JSON representation of a link used by metadata and management endpoints.
+func (h *Handlers) linkView(rec *core.URL) gin.H {
+	now := h.svc.Now()
+	expired := rec.Exhausted()
+	if rec.ExpiresAt != nil && now.After(*rec.ExpiresAt) {
+		expired = true
+	}
+	var remaining any // null for links without a cap
+	if n, ok := rec.RemainingHits(); ok {
+		remaining = n
+	}
+	return gin.H{
 		"code":       rec.Code,
 		"url":        rec.LongURL,
 		"created_at": rec.CreatedAt,
 		"expires_at": rec.ExpiresAt,
+		"starts_at":  rec.StartsAt,
+		"scheduled":  rec.StartsAt != nil && now.Before(*rec.StartsAt),
 		"hits":       rec.Hits,
 		"expired":    expired,
+		"archived":   rec.ArchivedAt != nil,
 		"short_url":  h.baseURL + "/" + rec.Code,
-	})
+
+		"redirect_type": h.redirectStatus(rec),
+		"protected":     rec.Protected(),
+
+		"max_hits":       rec.MaxHits,
+		"remaining_hits": remaining,
+
+		"status":            rec.LinkStatus(),
+		"status_reason":     rec.StatusReason,
+		"status_changed_at": rec.StatusChangedAt,
+	}
 }
 
-// ---- helpers ----
+// redirectStatus is the link's own redirect status or the server default.
+func (h *Handlers) redirectStatus(rec *core.URL) int {
+	if rec.RedirectType != 0 {
+		return rec.RedirectType
+	}
+	return h.defaultRedirect
+}
 
-func jsonError(c *gin.Context, status int, msg string) {
-	c.AbortWithStatusJSON(status, gin.H{"error": msg})
+// redirectCacheControl keeps temporary redirects out of every cache and
+// lets permanent ones be cached for at most permanentMaxAge, and never
+// past the link's expiry. Capped and password-protected links are never
+// cached: a cached redirect would not count against max_hits, and would skip
+// the unlock check for anyone sharing the cache or after the cookie expired.
+func redirectCacheControl(status int, rec *core.URL) string {
+	if (status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect) || rec.MaxHits > 0 || rec.Protected() {
+		return "no-store"
+	}
+	maxAge := permanentMaxAge
+	if rec.ExpiresAt != nil {
+		if left := time.Until(*rec.ExpiresAt); left < maxAge {
+			maxAge = max(left, 0)
+		}
+	}
+	if maxAge <= 0 {
+		return "no-store"
+	}
+	return "public, max-age=" + strconv.Itoa(int(maxAge/time.Second))
+}
+
+// nullableTimeField decodes an optional JSON timestamp: absent leaves it
+// unchanged, null clears it.
+func nullableTimeField(raw json.RawMessage) (t *time.Time, clear bool, err error) {
+	switch {
+	case len(raw) == 0:
+		return nil, false, nil
+	case string(raw) == "null":
+		return nil, true, nil
+	}
+	var v time.Time
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, false, err
+	}
+	return &v, false, nil
+}
+
+// parseTimeParam parses an optional RFC3339 query value; empty yields the zero time.
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
 }
@@ -5,8 +5,16 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,9 +22,19 @@ import (
 
 	"urlshorty/internal/app"
 	"urlshorty/internal/config"
+	"urlshorty/internal/core"
+	httpapi "urlshorty/internal/http"
+	"urlshorty/internal/id"
+	"urlshorty/internal/store/memory"
 )
 
 func newTestServer(t *testing.T) (*httptest.Server, func()) {
+	t.Helper()
+	return newTestServerWith(t, nil)
+}
+
+// newTestServerWith lets a test adjust the config before the app is built.
+func newTestServerWith(t *testing.T, tweak func(*config.Config)) (*httptest.Server, func()) {
 	t.Helper()
 	gin.SetMode(gin.TestMode)
 
@@ -28,6 +46,9 @@ func newTestServer(t *testing.T) (*httptest.Server, func()) {
 		RateLimitRPS:   0, // disable limiter in tests
 		RateLimitBurst: 0,
 	}
+	if tweak != nil {
+		tweak(&cfg)
+	}
 
 	a, err := app.New(context.Background(), cfg)
 	if err != nil {
@@ -62,6 +83,31 @@ func postJSON(t *testing.T, client *http.Client, url string, body any) (*http.Re
 	return res, data
 }
 
+// doJSON sends an authenticated request with an optional JSON body.
+func doJSON(t *testing.T, client *http.Client, method, url, key string, body any) (*http.Response, []byte) {
+	t.Helper()
+	var buf io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		buf = bytes.NewBuffer(b)
+	}
+	req, _ := http.NewRequest(method, url, buf)
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	data, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	return res, data
+}
+
 func get(t *testing.T, client *http.Client, url string) (*http.Response, []byte) {
 	t.Helper()
 	res, err := client.Get(url)
@@ -233,3 +279,957 @@ func TestURLShorty_EndToEnd(t *testing.T) {
 		}
 	}
 }
+
+func TestURLShorty_Stats(t *testing.T) {
+	const key = "test-admin-key"
+	ts, done := newTestServerWith(t, func(cfg *config.Config) { cfg.AdminAPIKey = key })
+	defer done()
+
+	base := ts.URL
+	nfClient := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, body := postJSON(t, ts.Client(), base+"/api/shorten", map[string]any{
+		"url":    "https://go.dev/doc/",
+		"custom": "stats",
+	})
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("shorten: status=%d body=%s", res.StatusCode, string(body))
+	}
+
+	// Two clicks from a referrer, one direct.
+	for i, ref := range []string{"https://news.ycombinator.com/item?id=1", "https://news.ycombinator.com/", ""} {
+		req, _ := http.NewRequest(http.MethodGet, base+"/stats", nil)
+		if ref != "" {
+			req.Header.Set("Referer", ref)
+		}
+		res, err := nfClient.Do(req)
+		if err != nil {
+			t.Fatalf("redirect %d: %v", i, err)
+		}
+		_ = res.Body.Close()
+	}
+
+	var st struct {
+		Bucket string `json:"bucket"`
+		Total  int64  `json:"total"`
+		Series []struct {
+			Count int64 `json:"count"`
+		} `json:"series"`
+		TopReferrers []struct {
+			Referrer string `json:"referrer"`
+			Count    int64  `json:"count"`
+		} `json:"top_referrers"`
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		res, body := doJSON(t, ts.Client(), http.MethodGet, base+"/api/stats/stats?bucket=hour", key, nil)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("stats: status=%d body=%s", res.StatusCode, string(body))
+		}
+		_ = json.Unmarshal(body, &st)
+		if st.Total >= 3 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if st.Total != 3 {
+		t.Fatalf("expected 3 clicks, got %d", st.Total)
+	}
+	if st.Bucket != "hour" || len(st.Series) != 24 && len(st.Series) != 25 {
+		t.Fatalf("unexpected series: bucket=%s len=%d", st.Bucket, len(st.Series))
+	}
+	if len(st.TopReferrers) == 0 || st.TopReferrers[0].Referrer != "news.ycombinator.com" || st.TopReferrers[0].Count != 2 {
+		t.Fatalf("unexpected top referrers: %+v", st.TopReferrers)
+	}
+
+	// Bad bucket and unknown code.
+	if res, _ := doJSON(t, ts.Client(), http.MethodGet, base+"/api/stats/stats?bucket=week", key, nil); res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad bucket: expected 400, got %d", res.StatusCode)
+	}
+	if res, _ := doJSON(t, ts.Client(), http.MethodGet, base+"/api/nope123/stats", key, nil); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown code: expected 404, got %d", res.StatusCode)
+	}
+	// Stats are not public.
+	if res, _ := get(t, ts.Client(), base+"/api/stats/stats"); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous stats: expected 401, got %d", res.StatusCode)
+	}
+}
+
+func TestURLShorty_ManageLinks(t *testing.T) {
+	const key = "test-admin-key"
+	ts, done := newTestServerWith(t, func(cfg *config.Config) { cfg.AdminAPIKey = key })
+	defer done()
+
+	base := ts.URL
+	c := ts.Client()
+
+	for _, alias := range []string{"one", "two", "three"} {
+		res, body := postJSON(t, c, base+"/api/shorten", map[string]any{
+			"url":    "https://example.com/" + alias,
+			"custom": alias,
+		})
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("shorten %s: status=%d body=%s", alias, res.StatusCode, string(body))
+		}
+	}
+
+	// Reserved alias is rejected.
+	if res, _ := postJSON(t, c, base+"/api/shorten", map[string]any{
+		"url": "https://example.com", "custom": "links",
+	}); res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("reserved alias: expected 400, got %d", res.StatusCode)
+	}
+
+	// Without or with a wrong key, management is refused.
+	if res, _ := doJSON(t, c, http.MethodDelete, base+"/api/one", "", nil); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("delete without key: expected 401, got %d", res.StatusCode)
+	}
+	if res, _ := doJSON(t, c, http.MethodPatch, base+"/api/one", "nope", map[string]any{
+		"url": "https://evil.example",
+	}); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("patch with wrong key: expected 401, got %d", res.StatusCode)
+	}
+
+	// Update destination and expiry, then clear the expiry.
+	{
+		exp := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		res, body := doJSON(t, c, http.MethodPatch, base+"/api/one", key, map[string]any{
+			"url":        "https://example.com/updated",
+			"expires_at": exp,
+		})
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("patch: status=%d body=%s", res.StatusCode, string(body))
+		}
+		var out struct {
+			URL       string  `json:"url"`
+			ExpiresAt *string `json:"expires_at"`
+		}
+		_ = json.Unmarshal(body, &out)
+		if out.URL != "https://example.com/updated" || out.ExpiresAt == nil {
+			t.Fatalf("patch: unexpected payload %s", string(body))
+		}
+		res, body = doJSON(t, c, http.MethodPatch, base+"/api/one", key, map[string]any{"expires_at": nil})
+		out.ExpiresAt = nil
+		_ = json.Unmarshal(body, &out)
+		if res.StatusCode != http.StatusOK || out.ExpiresAt != nil {
+			t.Fatalf("clear expiry: status=%d body=%s", res.StatusCode, string(body))
+		}
+	}
+
+	// List pages newest first.
+	{
+		res, body := doJSON(t, c, http.MethodGet, base+"/api/links?limit=2", key, nil)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("list: status=%d body=%s", res.StatusCode, string(body))
+		}
+		var page struct {
+			Links      []struct{ Code string } `json:"links"`
+			NextCursor string                  `json:"next_cursor"`
+		}
+		_ = json.Unmarshal(body, &page)
+		if len(page.Links) != 2 || page.Links[0].Code != "three" || page.NextCursor == "" {
+			t.Fatalf("list page 1: %s", string(body))
+		}
+		_, body = doJSON(t, c, http.MethodGet, base+"/api/links?limit=2&cursor="+page.NextCursor, key, nil)
+		page.NextCursor = ""
+		_ = json.Unmarshal(body, &page)
+		if len(page.Links) != 1 || page.Links[0].Code != "one" || page.NextCursor != "" {
+			t.Fatalf("list page 2: %s", string(body))
+		}
+	}
+
+	// Delete, then the link is gone.
+	if res, _ := doJSON(t, c, http.MethodDelete, base+"/api/two", key, nil); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d", res.StatusCode)
+	}
+	if res, _ := get(t, c, base+"/api/two"); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("after delete: expected 404, got %d", res.StatusCode)
+	}
+	if res, _ := doJSON(t, c, http.MethodDelete, base+"/api/two", key, nil); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("delete twice: expected 404, got %d", res.StatusCode)
+	}
+}
+
+func TestURLShorty_KeyOwnership(t *testing.T) {
+	const admin = "test-admin-key"
+	ts, done := newTestServerWith(t, func(cfg *config.Config) {
+		cfg.AdminAPIKey = admin
+		cfg.RequireAuth = true
+	})
+	defer done()
+
+	base := ts.URL
+	c := ts.Client()
+
+	newKey := func(name string) (int64, string) {
+		t.Helper()
+		res, body := doJSON(t, c, http.MethodPost, base+"/api/keys", admin, map[string]any{"name": name})
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("create key %s: status=%d body=%s", name, res.StatusCode, string(body))
+		}
+		var out struct {
+			ID  int64  `json:"id"`
+			Key string `json:"key"`
+		}
+		_ = json.Unmarshal(body, &out)
+		return out.ID, out.Key
+	}
+	aliceID, alice := newKey("alice")
+	_, bob := newKey("bob")
+
+	// Only admins manage keys.
+	if res, _ := doJSON(t, c, http.MethodPost, base+"/api/keys", alice, map[string]any{"name": "x"}); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("non-admin create key: expected 403, got %d", res.StatusCode)
+	}
+
+	// Anonymous shortening is disabled.
+	if res, _ := postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://example.com"}); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous shorten: expected 401, got %d", res.StatusCode)
+	}
+	if res, body := doJSON(t, c, http.MethodPost, base+"/api/shorten", alice, map[string]any{
+		"url": "https://example.com/alice", "custom": "alice1",
+	}); res.StatusCode != http.StatusCreated {
+		t.Fatalf("alice shorten: status=%d body=%s", res.StatusCode, string(body))
+	}
+	if res, body := doJSON(t, c, http.MethodPost, base+"/api/shorten", bob, map[string]any{
+		"url": "https://example.com/bob", "custom": "bob1",
+	}); res.StatusCode != http.StatusCreated {
+		t.Fatalf("bob shorten: status=%d body=%s", res.StatusCode, string(body))
+	}
+
+	// Bob cannot touch or inspect Alice's link; Alice and the admin can.
+	patch := map[string]any{"url": "https://example.com/changed"}
+	if res, _ := doJSON(t, c, http.MethodPatch, base+"/api/alice1", bob, patch); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("bob patch: expected 403, got %d", res.StatusCode)
+	}
+	if res, _ := doJSON(t, c, http.MethodGet, base+"/api/alice1/stats", bob, nil); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("bob stats: expected 403, got %d", res.StatusCode)
+	}
+	if res, _ := doJSON(t, c, http.MethodPatch, base+"/api/alice1", alice, patch); res.StatusCode != http.StatusOK {
+		t.Fatalf("alice patch: expected 200, got %d", res.StatusCode)
+	}
+	if res, _ := doJSON(t, c, http.MethodGet, base+"/api/alice1/stats", admin, nil); res.StatusCode != http.StatusOK {
+		t.Fatalf("admin stats: expected 200, got %d", res.StatusCode)
+	}
+
+	// Listings are scoped to the caller's own links.
+	var page struct {
+		Links []struct{ Code string } `json:"links"`
+	}
+	_, body := doJSON(t, c, http.MethodGet, base+"/api/links", alice, nil)
+	_ = json.Unmarshal(body, &page)
+	if len(page.Links) != 1 || page.Links[0].Code != "alice1" {
+		t.Fatalf("alice list: %s", string(body))
+	}
+	_, body = doJSON(t, c, http.MethodGet, base+"/api/links", admin, nil)
+	page.Links = nil
+	_ = json.Unmarshal(body, &page)
+	if len(page.Links) != 2 {
+		t.Fatalf("admin list: %s", string(body))
+	}
+
+	// A revoked key stops working.
+	if res, _ := doJSON(t, c, http.MethodDelete, base+"/api/keys/"+strconv.FormatInt(aliceID, 10), admin, nil); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("revoke: expected 204, got %d", res.StatusCode)
+	}
+	if res, _ := doJSON(t, c, http.MethodGet, base+"/api/links", alice, nil); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("revoked key: expected 401, got %d", res.StatusCode)
+	}
+}
+
+func TestURLShorty_Metrics(t *testing.T) {
+	ts, done := newTestServerWith(t, func(cfg *config.Config) {
+		cfg.MetricsEnabled = true
+		cfg.CacheSize = 100
+		cfg.RateLimitRPS, cfg.RateLimitBurst = 1, 1
+	})
+	defer done()
+	base := ts.URL
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	if res, _ := postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://go.dev/", "custom": "gopher"}); res.StatusCode != http.StatusCreated {
+		t.Fatalf("shorten: status=%d", res.StatusCode)
+	}
+	if res, _ := postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://go.dev/"}); res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("second shorten: expected 429, got %d", res.StatusCode)
+	}
+	get(t, c, base+"/gopher")
+	get(t, c, base+"/gopher")
+	get(t, c, base+"/missing")
+
+	res, body := get(t, c, base+"/metrics")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("metrics: status=%d", res.StatusCode)
+	}
+	for _, want := range []string{
+		`urlshorty_http_requests_total{method="GET",route="/:code",status="301"} 2`,
+		`urlshorty_http_requests_total{method="GET",route="/:code",status="404"} 1`,
+		`urlshorty_http_request_duration_seconds_count{method="POST",route="/api/shorten"} 2`,
+		`urlshorty_redirects_total{outcome="found"} 2`,
+		`urlshorty_redirects_total{outcome="not_found"} 1`,
+		`urlshorty_shorten_total{outcome="created"} 1`,
+		`urlshorty_rate_limited_total{route="/api/shorten"} 1`,
+		`urlshorty_store_query_duration_seconds_count{driver="sqlite",op="create"} 1`,
+		`urlshorty_cache_hits_total 1`,
+		`urlshorty_cache_misses_total 2`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output lacks %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("metrics output:\n%s", body)
+	}
+}
+
+func TestURLShorty_RequestLogging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	svc := core.NewService(memory.New(), id.NewGenerator(7), core.Options{})
+	ts := httptest.NewServer(httpapi.NewRouter(svc, httpapi.Options{
+		BaseURL: "http://example",
+		Logger:  slog.New(slog.NewJSONHandler(&logs, nil)),
+	}))
+	defer ts.Close()
+
+	// A client-supplied ID is echoed and logged.
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/missing", nil)
+	req.Header.Set("X-Request-ID", "trace-123")
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	_ = res.Body.Close()
+	if got := res.Header.Get("X-Request-ID"); got != "trace-123" {
+		t.Fatalf("expected echoed request id, got %q", got)
+	}
+	var line struct {
+		Msg       string `json:"msg"`
+		RequestID string `json:"request_id"`
+		Method    string `json:"method"`
+		Route     string `json:"route"`
+		Status    int    `json:"status"`
+		Code      string `json:"code"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("log line is not JSON: %v (%s)", err, logs.String())
+	}
+	if line.Msg != "request" || line.RequestID != "trace-123" || line.Method != "GET" ||
+		line.Route != "/:code" || line.Status != http.StatusNotFound || line.Code != "missing" {
+		t.Fatalf("unexpected log line: %s", logs.String())
+	}
+
+	// Malformed IDs are replaced with a generated one.
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/health", nil)
+	req.Header.Set("X-Request-ID", "bad id\twith spaces")
+	res, err = ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	_ = res.Body.Close()
+	if got := res.Header.Get("X-Request-ID"); got == "" || strings.Contains(got, " ") {
+		t.Fatalf("expected generated request id, got %q", got)
+	}
+}
+
+func TestURLShorty_RedirectTypes(t *testing.T) {
+	ts, done := newTestServerWith(t, func(cfg *config.Config) { cfg.RedirectStatus = http.StatusFound })
+	defer done()
+	base := ts.URL
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	for _, tc := range []struct {
+		custom       string
+		redirectType int
+		wantStatus   int
+		wantCache    string
+	}{
+		{"default", 0, http.StatusFound, "no-store"},
+		{"temp307", 307, http.StatusTemporaryRedirect, "no-store"},
+		{"perm301", 301, http.StatusMovedPermanently, "public, max-age=86400"},
+		{"perm308", 308, http.StatusPermanentRedirect, "public, max-age=86400"},
+	} {
+		body := map[string]any{"url": "https://go.dev/", "custom": tc.custom}
+		if tc.redirectType != 0 {
+			body["redirect_type"] = tc.redirectType
+		}
+		if res, b := postJSON(t, c, base+"/api/shorten", body); res.StatusCode != http.StatusCreated {
+			t.Fatalf("shorten %s: status=%d body=%s", tc.custom, res.StatusCode, b)
+		}
+		res, _ := get(t, c, base+"/"+tc.custom)
+		if res.StatusCode != tc.wantStatus {
+			t.Fatalf("%s: expected %d, got %d", tc.custom, tc.wantStatus, res.StatusCode)
+		}
+		if got := res.Header.Get("Cache-Control"); got != tc.wantCache {
+			t.Fatalf("%s: expected Cache-Control %q, got %q", tc.custom, tc.wantCache, got)
+		}
+	}
+
+	// Unsupported statuses are rejected.
+	res, _ := postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://go.dev/", "redirect_type": 303})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("redirect_type 303: expected 400, got %d", res.StatusCode)
+	}
+
+	// A permanent link that expires soon is cached no longer than its lifetime.
+	exp := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://go.dev/", "custom": "shortlived", "redirect_type": 301, "expires_at": exp})
+	res, _ = get(t, c, base+"/shortlived")
+	cc := res.Header.Get("Cache-Control")
+	age, err := strconv.Atoi(strings.TrimPrefix(cc, "public, max-age="))
+	if err != nil || age > 3600 || age < 3500 {
+		t.Fatalf("expiring permanent link: Cache-Control %q", cc)
+	}
+}
+
+func TestURLShorty_BlockedDestinations(t *testing.T) {
+	denylist := filepath.Join(t.TempDir(), "deny.txt")
+	if err := os.WriteFile(denylist, []byte("# phishing\n*.phish.example\n"), 0o600); err != nil {
+		t.Fatalf("write denylist: %v", err)
+	}
+	const key = "test-admin-key"
+	ts, done := newTestServerWith(t, func(cfg *config.Config) {
+		cfg.URLDenylistFile = denylist
+		cfg.AdminAPIKey = key
+	})
+	defer done()
+	base := ts.URL
+	c := ts.Client()
+
+	for _, u := range []string{
+		"http://127.0.0.1:6379/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/",
+		"https://login.phish.example/",
+		"http://EXAMPLE/loop", // our own BaseURL
+	} {
+		res, b := postJSON(t, c, base+"/api/shorten", map[string]any{"url": u})
+		if res.StatusCode != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: expected 422, got %d body=%s", u, res.StatusCode, b)
+		}
+	}
+
+	// Updating an existing link to a blocked destination is refused too.
+	if res, b := postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://go.dev/", "custom": "safe"}); res.StatusCode != http.StatusCreated {
+		t.Fatalf("shorten: status=%d body=%s", res.StatusCode, b)
+	}
+	res, _ := doJSON(t, c, http.MethodPatch, base+"/api/safe", key, map[string]any{"url": "http://10.0.0.1/"})
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("update to private address: expected 422, got %d", res.StatusCode)
+	}
+}
+
+func TestURLShorty_ThreatList(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "threats.txt")
+	if err := os.WriteFile(list, []byte("[MALWARE]\ndomain malware.example\n"), 0o600); err != nil {
+		t.Fatalf("write threat list: %v", err)
+	}
+	ts, done := newTestServerWith(t, func(cfg *config.Config) {
+		cfg.ThreatListFile = list
+		cfg.ThreatReloadInterval = 10 * time.Millisecond
+	})
+	defer done()
+	base := ts.URL
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// Listed destinations are refused up front.
+	if res, _ := postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://cdn.malware.example/x"}); res.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("listed destination: expected 422, got %d", res.StatusCode)
+	}
+
+	// A destination that turns bad later gets the interstitial after a reload.
+	if res, b := postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://later.example/login", "custom": "later"}); res.StatusCode != http.StatusCreated {
+		t.Fatalf("shorten: status=%d body=%s", res.StatusCode, b)
+	}
+	if res, _ := get(t, c, base+"/later"); res.StatusCode != http.StatusMovedPermanently {
+		t.Fatalf("before listing: expected 301, got %d", res.StatusCode)
+	}
+	if err := os.WriteFile(list, []byte("[SOCIAL_ENGINEERING]\ndomain later.example\n"), 0o600); err != nil {
+		t.Fatalf("update threat list: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		res, body := get(t, c, base+"/later")
+		if res.StatusCode == http.StatusOK {
+			if res.Header.Get("Location") != "" || !strings.Contains(string(body), "phishing") ||
+				!strings.Contains(string(body), "https://later.example/login") {
+				t.Fatalf("unexpected interstitial: headers=%v body=%s", res.Header, body)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("threat list was not reloaded: last status %d", res.StatusCode)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestURLShorty_LinkStatus(t *testing.T) {
+	const admin = "test-admin-key"
+	ts, done := newTestServerWith(t, func(cfg *config.Config) {
+		cfg.AdminAPIKey = admin
+	})
+	defer done()
+	base := ts.URL
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, body := doJSON(t, c, http.MethodPost, base+"/api/keys", admin, map[string]any{"name": "alice"})
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create key: status=%d body=%s", res.StatusCode, body)
+	}
+	var key struct {
+		Key string `json:"key"`
+	}
+	_ = json.Unmarshal(body, &key)
+	alice := key.Key
+	if res, b := doJSON(t, c, http.MethodPost, base+"/api/shorten", alice, map[string]any{
+		"url": "https://example.com/report", "custom": "report",
+	}); res.StatusCode != http.StatusCreated {
+		t.Fatalf("shorten: status=%d body=%s", res.StatusCode, b)
+	}
+
+	// Only admins change the status, and only to a known value.
+	if res, _ := doJSON(t, c, http.MethodPut, base+"/api/report/status", alice, map[string]any{"status": "disabled"}); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("owner set status: expected 403, got %d", res.StatusCode)
+	}
+	if res, _ := doJSON(t, c, http.MethodPut, base+"/api/report/status", admin, map[string]any{"status": "paused"}); res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown status: expected 400, got %d", res.StatusCode)
+	}
+	if res, _ := doJSON(t, c, http.MethodPut, base+"/api/missing/status", admin, map[string]any{"status": "disabled"}); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing link: expected 404, got %d", res.StatusCode)
+	}
+
+	if res, b := doJSON(t, c, http.MethodPut, base+"/api/report/status", admin, map[string]any{
+		"status": "disabled", "reason": "spam campaign",
+	}); res.StatusCode != http.StatusOK || !strings.Contains(string(b), `"status":"disabled"`) {
+		t.Fatalf("disable: status=%d body=%s", res.StatusCode, b)
+	}
+	res, body = get(t, c, base+"/report")
+	if res.StatusCode != http.StatusGone || res.Header.Get("Location") != "" || !strings.Contains(string(body), "spam campaign") {
+		t.Fatalf("disabled redirect: status=%d headers=%v body=%s", res.StatusCode, res.Header, body)
+	}
+
+	// Owners can still read a taken-down link but no longer change it.
+	if res, b := doJSON(t, c, http.MethodGet, base+"/api/report", alice, nil); res.StatusCode != http.StatusOK ||
+		!strings.Contains(string(b), `"status_reason":"spam campaign"`) || !strings.Contains(string(b), `"status_changed_at"`) {
+		t.Fatalf("metadata: status=%d body=%s", res.StatusCode, b)
+	}
+	if res, _ := doJSON(t, c, http.MethodPatch, base+"/api/report", alice, map[string]any{"url": "https://example.com/other"}); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("owner update of disabled link: expected 403, got %d", res.StatusCode)
+	}
+	if res, _ := doJSON(t, c, http.MethodDelete, base+"/api/report", alice, nil); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("owner delete of disabled link: expected 403, got %d", res.StatusCode)
+	}
+
+	if res, _ := doJSON(t, c, http.MethodPut, base+"/api/report/status", admin, map[string]any{"status": "quarantined"}); res.StatusCode != http.StatusOK {
+		t.Fatalf("quarantine: expected 200, got %d", res.StatusCode)
+	}
+	if res, _ := get(t, c, base+"/report"); res.StatusCode != http.StatusUnavailableForLegalReasons {
+		t.Fatalf("quarantined redirect: expected 451, got %d", res.StatusCode)
+	}
+
+	if res, _ := doJSON(t, c, http.MethodPut, base+"/api/report/status", admin, map[string]any{"status": "active"}); res.StatusCode != http.StatusOK {
+		t.Fatalf("reactivate: expected 200, got %d", res.StatusCode)
+	}
+	if res, _ := get(t, c, base+"/report"); res.StatusCode != http.StatusMovedPermanently || res.Header.Get("Location") != "https://example.com/report" {
+		t.Fatalf("reactivated redirect: status=%d location=%q", res.StatusCode, res.Header.Get("Location"))
+	}
+}
+
+func TestURLShorty_PasswordProtected(t *testing.T) {
+	ts, done := newTestServerWith(t, func(cfg *config.Config) {
+		cfg.UnlockTTL = time.Minute
+		cfg.UnlockAttempts = 3
+		cfg.UnlockAttemptInterval = time.Hour
+	})
+	defer done()
+	base := ts.URL
+	jar, _ := cookiejar.New(nil)
+	c := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	unlock := func(password string) *http.Response {
+		t.Helper()
+		res, err := c.PostForm(base+"/docs", url.Values{"password": {password}})
+		if err != nil {
+			t.Fatalf("POST /docs: %v", err)
+		}
+		_ = res.Body.Close()
+		return res
+	}
+
+	if res, b := postJSON(t, c, base+"/api/shorten", map[string]any{
+		"url": "https://example.com/private.pdf", "custom": "docs", "password": "s3cret",
+	}); res.StatusCode != http.StatusCreated {
+		t.Fatalf("shorten: status=%d body=%s", res.StatusCode, b)
+	}
+	if res, _ := postJSON(t, c, base+"/api/shorten", map[string]any{
+		"url": "https://example.com/", "password": strings.Repeat("x", 73),
+	}); res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("overlong password: expected 400, got %d", res.StatusCode)
+	}
+
+	// The destination is hidden from anonymous metadata lookups.
+	if res, b := get(t, c, base+"/api/docs"); res.StatusCode != http.StatusOK ||
+		strings.Contains(string(b), "private.pdf") || !strings.Contains(string(b), `"protected":true`) {
+		t.Fatalf("metadata: status=%d body=%s", res.StatusCode, b)
+	}
+
+	res, body := get(t, c, base+"/docs")
+	if res.StatusCode != http.StatusOK || res.Header.Get("Location") != "" ||
+		!strings.Contains(string(body), `type="password"`) || strings.Contains(string(body), "private.pdf") {
+		t.Fatalf("locked link: status=%d headers=%v body=%s", res.StatusCode, res.Header, body)
+	}
+	if res := unlock("wrong"); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("wrong password: expected 403, got %d", res.StatusCode)
+	}
+	res = unlock("s3cret")
+	if res.StatusCode != http.StatusSeeOther || res.Header.Get("Location") != "/docs" {
+		t.Fatalf("unlock: status=%d location=%q", res.StatusCode, res.Header.Get("Location"))
+	}
+	if res, _ := get(t, c, base+"/docs"); res.StatusCode != http.StatusMovedPermanently || res.Header.Get("Location") != "https://example.com/private.pdf" ||
+		res.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("unlocked redirect: status=%d location=%q cache-control=%q", res.StatusCode, res.Header.Get("Location"), res.Header.Get("Cache-Control"))
+	}
+
+	// A forged cookie does not unlock.
+	other := &http.Client{CheckRedirect: c.CheckRedirect}
+	req, _ := http.NewRequest(http.MethodGet, base+"/docs", nil)
+	req.AddCookie(&http.Cookie{Name: "urlshorty_unlock", Value: "9999999999.AAAA"})
+	if res, err := other.Do(req); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("forged cookie: res=%v err=%v", res, err)
+	}
+
+	// The third attempt uses up the burst; the next one is throttled even
+	// with the right password.
+	if res := unlock("wrong"); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("wrong password: expected 403, got %d", res.StatusCode)
+	}
+	if res := unlock("s3cret"); res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("throttled attempt: expected 429, got %d", res.StatusCode)
+	}
+}
+
+func TestURLShorty_MaxHits(t *testing.T) {
+	ts, done := newTestServer(t)
+	defer done()
+	base := ts.URL
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	if res, _ := postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://example.com/", "max_hits": -1}); res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("negative max_hits: expected 400, got %d", res.StatusCode)
+	}
+	if res, b := postJSON(t, c, base+"/api/shorten", map[string]any{
+		"url": "https://example.com/invite", "custom": "invite", "max_hits": 2,
+	}); res.StatusCode != http.StatusCreated {
+		t.Fatalf("shorten: status=%d body=%s", res.StatusCode, b)
+	}
+	remaining := func() (int64, bool) {
+		t.Helper()
+		res, b := get(t, c, base+"/api/invite")
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("metadata: status=%d body=%s", res.StatusCode, b)
+		}
+		var out struct {
+			MaxHits       int64 `json:"max_hits"`
+			RemainingHits int64 `json:"remaining_hits"`
+			Expired       bool  `json:"expired"`
+		}
+		_ = json.Unmarshal(b, &out)
+		if out.MaxHits != 2 {
+			t.Fatalf("max_hits = %d, want 2", out.MaxHits)
+		}
+		return out.RemainingHits, out.Expired
+	}
+	if n, expired := remaining(); n != 2 || expired {
+		t.Fatalf("before use: remaining=%d expired=%v", n, expired)
+	}
+
+	for i := 0; i < 2; i++ {
+		res, _ := get(t, c, base+"/invite")
+		if res.StatusCode != http.StatusMovedPermanently || res.Header.Get("Cache-Control") != "no-store" {
+			t.Fatalf("use %d: status=%d cache-control=%q", i+1, res.StatusCode, res.Header.Get("Cache-Control"))
+		}
+	}
+	if res, _ := get(t, c, base+"/invite"); res.StatusCode != http.StatusGone {
+		t.Fatalf("spent link: expected 410, got %d", res.StatusCode)
+	}
+	if n, expired := remaining(); n != 0 || !expired {
+		t.Fatalf("after use: remaining=%d expired=%v", n, expired)
+	}
+}
+
+func TestURLShorty_ScheduledLinks(t *testing.T) {
+	const key = "test-admin-key"
+	page := filepath.Join(t.TempDir(), "soon.html")
+	if err := os.WriteFile(page, []byte(`<p>/{{.Code}} launches {{.StartsAt.Format "2006-01-02"}}</p>`), 0o600); err != nil {
+		t.Fatalf("write page: %v", err)
+	}
+	start := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	cases := []struct {
+		name   string
+		tweak  func(*config.Config)
+		status int
+		body   string
+	}{
+		{"placeholder", nil, http.StatusOK, "not live yet"},
+		{"custom page", func(cfg *config.Config) { cfg.ScheduledPageFile = page }, http.StatusOK, "/launch launches " + start.Format("2006-01-02")},
+		{"not found", func(cfg *config.Config) { cfg.ScheduledNotFound = true }, http.StatusNotFound, "not found"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts, done := newTestServerWith(t, func(cfg *config.Config) {
+				cfg.AdminAPIKey = key
+				if tc.tweak != nil {
+					tc.tweak(cfg)
+				}
+			})
+			defer done()
+			base := ts.URL
+			c := &http.Client{
+				CheckRedirect: func(req *http.Request, via []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			}
+
+			if res, _ := postJSON(t, c, base+"/api/shorten", map[string]any{
+				"url": "https://example.com/", "starts_at": start, "expires_at": start.Add(-time.Minute),
+			}); res.StatusCode != http.StatusBadRequest {
+				t.Fatalf("window ending before it starts: expected 400, got %d", res.StatusCode)
+			}
+			if res, b := postJSON(t, c, base+"/api/shorten", map[string]any{
+				"url": "https://example.com/launch", "custom": "launch", "starts_at": start,
+			}); res.StatusCode != http.StatusCreated {
+				t.Fatalf("shorten: status=%d body=%s", res.StatusCode, b)
+			}
+
+			res, body := get(t, c, base+"/launch")
+			if res.StatusCode != tc.status || res.Header.Get("Location") != "" || !strings.Contains(string(body), tc.body) {
+				t.Fatalf("before start: status=%d headers=%v body=%s", res.StatusCode, res.Header, body)
+			}
+			if res, b := get(t, c, base+"/api/launch"); res.StatusCode != http.StatusOK ||
+				!strings.Contains(string(b), `"scheduled":true`) || !strings.Contains(string(b), `"starts_at":"`+start.Format(time.RFC3339)) {
+				t.Fatalf("metadata: status=%d body=%s", res.StatusCode, b)
+			}
+
+			// Clearing starts_at makes the link live right away.
+			if res, b := doJSON(t, c, http.MethodPatch, base+"/api/launch", key, map[string]any{"starts_at": nil}); res.StatusCode != http.StatusOK {
+				t.Fatalf("clear starts_at: status=%d body=%s", res.StatusCode, b)
+			}
+			if res, _ := get(t, c, base+"/launch"); res.StatusCode != http.StatusMovedPermanently {
+				t.Fatalf("after clearing starts_at: expected 301, got %d", res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestURLShorty_TTL(t *testing.T) {
+	const key = "test-admin-key"
+	ts, done := newTestServerWith(t, func(cfg *config.Config) {
+		cfg.AdminAPIKey = key
+		cfg.MaxTTL = 30 * 24 * time.Hour
+		cfg.AnonymousDefaultTTL = 24 * time.Hour
+	})
+	defer done()
+	base := ts.URL
+	c := &http.Client{}
+
+	expiresIn := func(b []byte) time.Duration {
+		t.Helper()
+		var out struct {
+			ExpiresAt *time.Time `json:"expires_at"`
+		}
+		if err := json.Unmarshal(b, &out); err != nil || out.ExpiresAt == nil {
+			t.Fatalf("no expires_at in %s", b)
+		}
+		return time.Until(*out.ExpiresAt).Round(time.Hour)
+	}
+	res, b := postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://example.com/week", "ttl": "P7D"})
+	if res.StatusCode != http.StatusCreated || expiresIn(b) != 7*24*time.Hour {
+		t.Fatalf("ttl P7D: status=%d body=%s", res.StatusCode, b)
+	}
+	res, b = postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://example.com/anon"})
+	if res.StatusCode != http.StatusCreated || expiresIn(b) != 24*time.Hour {
+		t.Fatalf("anonymous default: status=%d body=%s", res.StatusCode, b)
+	}
+	res, b = doJSON(t, c, http.MethodPost, base+"/api/shorten", key, map[string]any{"url": "https://example.com/owned", "custom": "owned"})
+	if res.StatusCode != http.StatusCreated || expiresIn(b) != 30*24*time.Hour {
+		t.Fatalf("authenticated default: status=%d body=%s", res.StatusCode, b)
+	}
+
+	for _, tc := range []struct {
+		body map[string]any
+		msg  string
+	}{
+		{map[string]any{"url": "https://example.com/", "ttl": "1000h"}, "1000h exceeds the maximum of 30 days"},
+		{map[string]any{"url": "https://example.com/", "ttl": "P1M"}, "years or months"},
+		{map[string]any{"url": "https://example.com/", "ttl": "soon"}, "cannot parse"},
+		{map[string]any{"url": "https://example.com/", "ttl": "1h", "expires_at": time.Now().Add(time.Hour)}, "not both"},
+	} {
+		res, b := postJSON(t, c, base+"/api/shorten", tc.body)
+		if res.StatusCode != http.StatusBadRequest || !strings.Contains(string(b), tc.msg) {
+			t.Errorf("%v: status=%d body=%s", tc.body, res.StatusCode, b)
+		}
+	}
+
+	if res, b := doJSON(t, c, http.MethodPatch, base+"/api/owned", key, map[string]any{"expires_at": nil}); res.StatusCode != http.StatusBadRequest ||
+		!strings.Contains(string(b), "must expire within 30 days") {
+		t.Fatalf("clearing expiry past the maximum: status=%d body=%s", res.StatusCode, b)
+	}
+}
+
+func TestURLShorty_BulkShorten(t *testing.T) {
+	ts, done := newTestServerWith(t, func(cfg *config.Config) {
+		cfg.BulkMaxItems = 3
+		cfg.RateLimitRPS, cfg.RateLimitBurst = 1, 5
+	})
+	defer done()
+	base := ts.URL
+	c := &http.Client{}
+
+	type result struct {
+		Index    int    `json:"index"`
+		Status   int    `json:"status"`
+		Code     string `json:"code"`
+		ShortURL string `json:"short_url"`
+		Error    string `json:"error"`
+	}
+	bulk := func(body map[string]any) (int, []result) {
+		t.Helper()
+		res, b := postJSON(t, c, base+"/api/shorten/bulk", body)
+		var out struct {
+			Results []result `json:"results"`
+		}
+		_ = json.Unmarshal(b, &out)
+		return res.StatusCode, out.Results
+	}
+
+	// Partial: the invalid item fails alone (costs 3 tokens).
+	status, results := bulk(map[string]any{"items": []map[string]any{
+		{"url": "https://example.com/one"},
+		{"url": "not a url"},
+		{"url": "https://example.com/two", "custom": "two"},
+	}})
+	if status != http.StatusMultiStatus || len(results) != 3 ||
+		results[0].Status != http.StatusCreated || results[0].ShortURL != "http://example/"+results[0].Code ||
+		results[1].Status != http.StatusBadRequest || results[1].Error != "invalid url" ||
+		results[2].Status != http.StatusCreated || results[2].Code != "two" || results[2].Index != 2 {
+		t.Fatalf("partial: status=%d results=%+v", status, results)
+	}
+	if res, b := get(t, c, base+"/api/"+results[0].Code); res.StatusCode != http.StatusOK {
+		t.Fatalf("metadata of a bulk link: status=%d body=%s", res.StatusCode, b)
+	}
+
+	// All-or-nothing: the taken alias fails the batch with its own status (2 tokens).
+	status, results = bulk(map[string]any{"atomic": true, "items": []map[string]any{
+		{"url": "https://example.com/three", "custom": "three"},
+		{"url": "https://example.com/two", "custom": "two"},
+	}})
+	if status != http.StatusConflict || len(results) != 2 ||
+		results[0].Status != http.StatusFailedDependency || results[0].Code != "" || results[1].Status != http.StatusConflict {
+		t.Fatalf("atomic: status=%d results=%+v", status, results)
+	}
+	if res, _ := get(t, c, base+"/api/three"); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("aborted item was created: status=%d", res.StatusCode)
+	}
+
+	// Too many items never reach the limiter.
+	if status, _ := bulk(map[string]any{"items": make([]map[string]any, 4)}); status != http.StatusBadRequest {
+		t.Fatalf("4 items over a max of 3: expected 400, got %d", status)
+	}
+	if status, _ := bulk(map[string]any{"items": []map[string]any{}}); status != http.StatusBadRequest {
+		t.Fatalf("no items: expected 400, got %d", status)
+	}
+	if status, _ := bulk(map[string]any{"items": []map[string]any{{"url": "https://example.com/" + strings.Repeat("x", 16<<10)}}}); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized body: expected 413, got %d", status)
+	}
+
+	// The 5-token burst is spent, so even a single shorten waits now.
+	if res, _ := postJSON(t, c, base+"/api/shorten", map[string]any{"url": "https://example.com/"}); res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("shorten after bulk: expected 429, got %d", res.StatusCode)
+	}
+	if status, _ := bulk(map[string]any{"items": []map[string]any{{"url": "https://example.com/"}}}); status != http.StatusTooManyRequests {
+		t.Fatalf("bulk after bulk: expected 429, got %d", status)
+	}
+}
+
+func TestURLShorty_MetadataUsesServiceClock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Now().UTC()
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	setClock := func(t time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = t
+	}
+	start, exp := now.Add(time.Hour), now.Add(2*time.Hour)
+	svc := core.NewService(memory.New(), id.NewGenerator(7), core.Options{Now: clock})
+	if _, err := svc.Shorten(context.Background(), core.CreateRequest{
+		URL: "https://example.com/window", Custom: "window", StartsAt: &start, ExpiresAt: &exp,
+	}); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	ts := httptest.NewServer(httpapi.NewRouter(svc, httpapi.Options{BaseURL: "http://example"}))
+	defer ts.Close()
+	c := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	for _, tc := range []struct {
+		at                 time.Time
+		redirect           int
+		scheduled, expired bool
+	}{
+		{start.Add(-time.Minute), http.StatusOK, true, false},
+		{start.Add(time.Minute), http.StatusMovedPermanently, false, false},
+		{exp.Add(time.Minute), http.StatusGone, false, true},
+	} {
+		setClock(tc.at)
+		if res, _ := get(t, c, ts.URL+"/window"); res.StatusCode != tc.redirect {
+			t.Fatalf("at %v: redirect status=%d, want %d", tc.at, res.StatusCode, tc.redirect)
+		}
+		_, b := get(t, c, ts.URL+"/api/window")
+		var view struct {
+			Scheduled bool `json:"scheduled"`
+			Expired   bool `json:"expired"`
+		}
+		_ = json.Unmarshal(b, &view)
+		if view.Scheduled != tc.scheduled || view.Expired != tc.expired {
+			t.Fatalf("at %v: metadata %s, want scheduled=%v expired=%v", tc.at, b, tc.scheduled, tc.expired)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"errors"
+
+	"urlshorty/internal/core"
+	"urlshorty/internal/metrics"
+)
+
+// Metrics are the HTTP-level collectors. A nil *Metrics disables them.
+type Metrics struct {
+	Requests    *metrics.CounterVec   // method, route, status
+	Latency     *metrics.HistogramVec // method, route
+	Redirects   *metrics.CounterVec   // outcome
+	Shortens    *metrics.CounterVec   // outcome
+	RateLimited *metrics.CounterVec   // route
+}
+
+// NewMetrics registers the HTTP collectors in reg.
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		Requests: reg.Counter("urlshorty_http_requests_total",
+			"HTTP requests by method, route and status.", "method", "route", "status"),
+		Latency: reg.Histogram("urlshorty_http_request_duration_seconds",
+			"HTTP request latency by method and route.", nil, "method", "route"),
+		Redirects: reg.Counter("urlshorty_redirects_total",
+			"Redirect lookups by outcome (found, not_found, expired, invalid_code, error).", "outcome"),
+		Shortens: reg.Counter("urlshorty_shorten_total",
+			"Shorten requests by outcome (created or the error returned).", "outcome"),
+		RateLimited: reg.Counter("urlshorty_rate_limited_total",
+			"Requests rejected by the rate limiter, by route.", "route"),
+	}
+}
+
+func (m *Metrics) redirect(outcome string) {
+	if m != nil {
+		m.Redirects.Inc(outcome)
+	}
+}
+
+func (m *Metrics) shorten(outcome string) {
+	if m != nil {
+		m.Shortens.Inc(outcome)
+	}
+}
+
+func (m *Metrics) rateLimited(route string) {
+	if m != nil {
+		m.RateLimited.Inc(route)
+	}
+}
+
+// outcome maps a service error to a metric label value.
+func outcome(err error) string {
+	if errors.Is(err, core.ErrInvalidTTL) {
+		return "invalid_ttl"
+	}
+	switch err {
+	case nil:
+		return "ok"
+	case core.ErrInvalidURL:
+		return "invalid_url"
+	case core.ErrInvalidCode:
+		return "invalid_code"
+	case core.ErrInvalidRedirect:
+		return "invalid_redirect"
+	case core.ErrBlockedURL:
+		return "blocked"
+	case core.ErrInvalidPassword:
+		return "invalid_password"
+	case core.ErrInvalidMaxHits:
+		return "invalid_max_hits"
+	case core.ErrInvalidWindow:
+		return "invalid_window"
+	case core.ErrNotYetActive:
+		return "scheduled"
+	case core.ErrConflict:
+		return "conflict"
+	case core.ErrBatchAborted:
+		return "aborted"
+	case core.ErrBatchPasswords:
+		return "too_many_passwords"
+	case core.ErrNotFound:
+		return "not_found"
+	case core.ErrExpired:
+		return "expired"
+	case core.ErrDisabled:
+		return "disabled"
+	case core.ErrQuarantined:
+		return "quarantined"
+	case core.ErrUnauthorized:
+		return "unauthorized"
+	case core.ErrForbidden:
+		return "forbidden"
+	default:
+		return "error"
+	}
+}
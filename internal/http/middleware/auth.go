@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"urlshorty/internal/core"
+)
+
+// Authenticator resolves bearer tokens to callers (implemented by *core.Service).
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*core.Principal, error)
+}
+
+// Auth authenticates "Authorization: Bearer <key>" and stores the caller in
+// the request context (see core.PrincipalFrom). An invalid key is always
+// rejected with 401; a missing one only when required is true.
+func Auth(authn Authenticator, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := BearerToken(c.Request)
+		if token == "" {
+			if required {
+				unauthorized(c)
+				return
+			}
+			c.Next()
+			return
+		}
+		p, err := authn.Authenticate(c.Request.Context(), token)
+		if err != nil {
+			if core.IsUnauthorized(err) {
+				unauthorized(c)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			return
+		}
+		c.Request = c.Request.WithContext(core.WithPrincipal(c.Request.Context(), p))
+		c.Next()
+	}
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func BearerToken(r *http.Request) string {
+	h := strings.TrimSpace(r.Header.Get("Authorization"))
+	const prefix = "bearer "
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(h[len(prefix):])
+}
+
+func unauthorized(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Bearer realm="urlshorty"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"urlshorty/internal/metrics"
+)
+
+// Metrics counts requests and observes their latency per route template
+// (e.g. "/api/:code"), so codes never become label values.
+func Metrics(requests *metrics.CounterVec, latency *metrics.HistogramVec) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		requests.Inc(method, route, strconv.Itoa(c.Writer.Status()))
+		latency.ObserveSince(start, method, route)
+	}
+}
@@ -5,14 +5,17 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"urlshorty/internal/metrics"
 	"urlshorty/internal/rate"
 )
 
 // RateLimit enforces a simple per-IP token bucket for the current route.
-func RateLimit(lim *rate.Limiter) gin.HandlerFunc {
+// Rejections are counted in rejected (by route) when it is non-nil.
+func RateLimit(lim *rate.Limiter, rejected *metrics.CounterVec) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
 		if !lim.Allow(ip) {
+			rejected.Inc(c.FullPath())
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limited"})
 			return
 		}
@@ -1,6 +1,55 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
 
-// Recover adds panic recovery with a 500 if something goes wrong.
-func Recover() gin.HandlerFunc { return gin.Recovery() }
+	"github.com/gin-gonic/gin"
+
+	"urlshorty/internal/core"
+)
+
+// Recover turns a panic into a 500 and logs it, with the stack, through the
+// request's logger. http.ErrAbortHandler is re-panicked for net/http to
+// handle, and writes to a client that hung up are logged without a stack
+// and not answered.
+func Recover() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+			log := core.LoggerFrom(c.Request.Context())
+			if err, ok := r.(error); ok && brokenPipe(err) {
+				// The connection is dead, so there is no one to answer.
+				log.Warn("client connection lost", "error", err)
+				_ = c.Error(err)
+				c.Abort()
+				return
+			}
+			log.Error("panic recovered", "panic", r, "stack", string(debug.Stack()))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+		}()
+		c.Next()
+	}
+}
+
+// brokenPipe reports whether err comes from writing to a connection the
+// client already closed.
+func brokenPipe(err error) bool {
+	var ne *net.OpError
+	var se *os.SyscallError
+	if !errors.As(err, &ne) || !errors.As(ne, &se) {
+		return false
+	}
+	msg := strings.ToLower(se.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
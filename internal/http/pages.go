@@ -0,0 +1,163 @@
+package http
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"urlshorty/internal/core"
+)
+
+// pageLayout is shared by the HTML pages served instead of a redirect. Each
+// page defines "title" and "body".
+const pageLayout = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8"/>
+<meta name="viewport" content="width=device-width,initial-scale=1"/>
+<meta name="robots" content="noindex"/>
+<title>{{template "title" .}}</title>
+<style>
+body{font-family:system-ui,-apple-system,Segoe UI,Roboto,Ubuntu,Cantarell,Noto Sans,sans-serif;margin:0;padding:2rem;background:#0b0b0c;color:#e8e8ea}
+.container{max-width:680px;margin:0 auto}
+.card{background:#151517;border:1px solid #2b2b2f;border-radius:12px;padding:1.25rem}
+.warn{background:#2a1215;border-color:#7a2a31}
+h1{font-size:1.25rem;margin:0 0 1rem}
+code{display:block;white-space:pre-wrap;word-break:break-all;background:#0f0f11;border:1px solid #2b2b2f;border-radius:8px;padding:.75rem;margin:.75rem 0}
+small{opacity:.7}
+form{display:flex;gap:.5rem;margin:1rem 0}
+input{flex:1;padding:.6rem;border-radius:8px;border:1px solid #2b2b2f;background:#0f0f11;color:inherit}
+button{padding:.6rem 1rem;border-radius:8px;border:0;background:#3b82f6;color:#fff;cursor:pointer}
+.error{color:#f87171}
+</style>
+</head>
+<body>
+<div class="container">
+{{template "body" .}}
+</div>
+</body>
+</html>
+`
+
+func newPage(body string) *template.Template {
+	return template.Must(template.Must(template.New("page").Parse(pageLayout)).Parse(body))
+}
+
+// interstitialPage is shown instead of redirecting when a link's destination
+// is on the threat list. The destination is displayed as text only.
+var interstitialPage = newPage(`{{define "title"}}Warning: unsafe link{{end}}
+{{define "body"}}  <div class="card warn">
+    <h1>This link has been blocked</h1>
+    <p>The short link <strong>/{{.Code}}</strong> points to a site reported for <strong>{{.Threat}}</strong>. Visiting it may put your device or personal information at risk, so we did not redirect you.</p>
+    <code>{{.Destination}}</code>
+    <small>If you believe this is a mistake, contact the owner of this service.</small>
+  </div>{{end}}`)
+
+// unavailablePage explains why a disabled or quarantined link no longer
+// redirects.
+var unavailablePage = newPage(`{{define "title"}}Link unavailable{{end}}
+{{define "body"}}  <div class="card">
+    <h1>{{.Heading}}</h1>
+    <p>{{.Message}}</p>
+    {{if .Reason}}<code>{{.Reason}}</code>{{end}}
+    <small>If you believe this is a mistake, contact the owner of this service.</small>
+  </div>{{end}}`)
+
+// unlockPage asks for the password of a protected link. It posts back to
+// the short URL itself (see Handlers.Unlock).
+var unlockPage = newPage(`{{define "title"}}Password required{{end}}
+{{define "body"}}  <div class="card">
+    <h1>This link is password protected</h1>
+    <p>Enter the password to continue to the destination of <strong>/{{.Code}}</strong>.</p>
+    {{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+    <form method="post">
+      <input type="password" name="password" autocomplete="current-password" autofocus required/>
+      <button type="submit">Continue</button>
+    </form>
+  </div>{{end}}`)
+
+// scheduledPage is the default placeholder for links whose starts_at has
+// not come yet (see Options.ScheduledPage).
+var scheduledPage = newPage(`{{define "title"}}Coming soon{{end}}
+{{define "body"}}  <div class="card">
+    <h1>This link is not live yet</h1>
+    <p>The short link <strong>/{{.Code}}</strong> goes live on {{.StartsAt.Format "Mon, 02 Jan 2006 15:04 MST"}}. Please come back then.</p>
+  </div>{{end}}`)
+
+// threatLabels turns list threat types into phrases for the warning page.
+var threatLabels = map[string]string{
+	"MALWARE":                         "malware",
+	"SOCIAL_ENGINEERING":              "phishing",
+	"PHISHING":                        "phishing",
+	"UNWANTED_SOFTWARE":               "unwanted software",
+	"POTENTIALLY_HARMFUL_APPLICATION": "harmful applications",
+}
+
+func threatLabel(threat string) string {
+	if l, ok := threatLabels[threat]; ok {
+		return l
+	}
+	if threat == "" || threat == "UNSPECIFIED" {
+		return "abuse"
+	}
+	return strings.ToLower(strings.ReplaceAll(threat, "_", " "))
+}
+
+// renderPage writes an HTML page that must not be cached or indexed.
+func renderPage(c *gin.Context, status int, page *template.Template, data any) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("X-Robots-Tag", "noindex")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	_ = page.Execute(c.Writer, data)
+}
+
+// renderInterstitial writes the warning page for a flagged link.
+func renderInterstitial(c *gin.Context, code, destination, threat string) {
+	renderPage(c, http.StatusOK, interstitialPage, struct {
+		Code, Destination, Threat string
+	}{code, destination, threatLabel(threat)})
+}
+
+// renderUnavailable answers a disabled link with 410 Gone and a quarantined
+// one with 451 Unavailable For Legal Reasons.
+func renderUnavailable(c *gin.Context, rec *core.URL) {
+	status := http.StatusGone
+	data := struct{ Heading, Message, Reason string }{
+		Heading: "This link has been disabled",
+		Message: "The short link /" + rec.Code + " was taken down by the operators of this service and no longer redirects.",
+		Reason:  rec.StatusReason,
+	}
+	if rec.LinkStatus() == core.StatusQuarantined {
+		status = http.StatusUnavailableForLegalReasons
+		data.Heading = "This link is unavailable"
+		data.Message = "The short link /" + rec.Code + " has been withheld following a legal or abuse complaint and no longer redirects."
+	}
+	renderPage(c, status, unavailablePage, data)
+}
+
+// renderUnlock writes the password form for a protected link, with an
+// optional error from the previous attempt.
+func renderUnlock(c *gin.Context, status int, code, msg string) {
+	renderPage(c, status, unlockPage, struct{ Code, Error string }{code, msg})
+}
+
+// ScheduledPageData is passed to the placeholder page of a scheduled link.
+type ScheduledPageData struct {
+	Code     string
+	StartsAt time.Time // UTC
+}
+
+// renderScheduled answers a link before its starts_at with the placeholder
+// page, or as an unknown code when scheduled links are hidden.
+func (h *Handlers) renderScheduled(c *gin.Context, rec *core.URL) {
+	if h.scheduledNotFound {
+		jsonError(c, http.StatusNotFound, "not found")
+		return
+	}
+	renderPage(c, http.StatusOK, h.scheduledPage, ScheduledPageData{Code: rec.Code, StartsAt: rec.StartsAt.UTC()})
+}
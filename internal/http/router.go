@@ -1,18 +1,46 @@
 package http
 
 import (
+	"html/template"
 	"log"
+	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"urlshorty/internal/core"
 	"urlshorty/internal/http/middleware"
+	"urlshorty/internal/metrics"
 	"urlshorty/internal/rate"
 )
 
 type Options struct {
 	BaseURL     string
-	RateLimiter *rate.Limiter // used for POST /api/shorten only
+	RateLimiter *rate.Limiter // used for POST /api/shorten and, per item, POST /api/shorten/bulk
+	Logger      *slog.Logger  // request log (nil = slog.Default())
+	Metrics     *Metrics      // request/outcome collectors (nil = not instrumented)
+	// MetricsHandler is served at GET /metrics when set. Leave it nil when
+	// metrics are exposed on a separate listener instead.
+	MetricsHandler http.Handler
+	// RedirectStatus is used for links without their own redirect type
+	// (301, 302, 307 or 308; 0 = 301).
+	RedirectStatus int
+	// UnlockSecret signs the cookies that remember an unlocked
+	// password-protected link ("" = random per process).
+	UnlockSecret string
+	// UnlockTTL is how long an unlocked link stays unlocked (0 = 15m).
+	UnlockTTL time.Duration
+	// UnlockLimiter throttles password attempts per code and client IP.
+	UnlockLimiter *rate.Limiter
+	// ScheduledPage replaces the placeholder shown for links before their
+	// starts_at. It is executed with a ScheduledPageData (nil = built-in).
+	ScheduledPage *template.Template
+	// ScheduledNotFound answers links before their starts_at with 404, as if
+	// they did not exist, instead of the placeholder.
+	ScheduledNotFound bool
+	// BulkMaxItems caps the items of one POST /api/shorten/bulk (0 = 100).
+	BulkMaxItems int
 }
 
 // NewRouter sets up all routes and middleware.
@@ -23,29 +51,73 @@ func NewRouter(svc *core.Service, opts Options) *gin.Engine {
 		log.Printf("SetTrustedProxies: %v", err)
 	}
 
-	r.Use(middleware.Logger())
+	r.Use(middleware.Logger(opts.Logger))
 	r.Use(middleware.Recover())
+	var rejected *metrics.CounterVec
+	if m := opts.Metrics; m != nil {
+		r.Use(middleware.Metrics(m.Requests, m.Latency))
+		rejected = m.RateLimited
+	}
 
 	h := NewHandlers(svc, opts.BaseURL)
+	h.metrics = opts.Metrics
+	if core.ValidRedirectType(opts.RedirectStatus) && opts.RedirectStatus != 0 {
+		h.defaultRedirect = opts.RedirectStatus
+	}
+	if opts.UnlockSecret != "" {
+		h.unlockKey = unlockKey(opts.UnlockSecret)
+	}
+	if opts.UnlockTTL > 0 {
+		h.unlockTTL = opts.UnlockTTL
+	}
+	h.unlockLimiter = opts.UnlockLimiter
+	if opts.ScheduledPage != nil {
+		h.scheduledPage = opts.ScheduledPage
+	}
+	h.scheduledNotFound = opts.ScheduledNotFound
+	h.shortenLimiter = opts.RateLimiter
+	if opts.BulkMaxItems > 0 {
+		h.bulkMaxItems = opts.BulkMaxItems
+	}
 
 	// Health
 	r.GET("/health", h.Health)
 
+	// Prometheus metrics
+	if opts.MetricsHandler != nil {
+		r.GET("/metrics", gin.WrapH(opts.MetricsHandler))
+	}
+
 	// Optional tiny UI (inline HTML)
 	RegisterStatic(r)
 
-	// API
-	api := r.Group("/api")
+	// API (bearer key optional here; the service decides what needs one)
+	api := r.Group("/api", middleware.Auth(svc, false))
 	// POST /api/shorten (rate-limited if limiter provided)
 	if opts.RateLimiter != nil {
-		api.POST("/shorten", middleware.RateLimit(opts.RateLimiter), h.Shorten)
+		api.POST("/shorten", middleware.RateLimit(opts.RateLimiter, rejected), h.Shorten)
 	} else {
 		api.POST("/shorten", h.Shorten)
 	}
+	// Bulk shorten charges the limiter per item itself, after reading the body.
+	api.POST("/shorten/bulk", h.ShortenBulk)
 	api.GET("/:code", h.Metadata)
+	api.GET("/:code/stats", h.Stats)
+
+	// Link management (owner or admin key)
+	api.GET("/links", h.List)
+	api.PATCH("/:code", h.Update)
+	api.DELETE("/:code", h.Delete)
+	api.PUT("/:code/status", h.SetStatus) // admin only
+
+	// API key management (admin key)
+	api.POST("/keys", h.CreateKey)
+	api.GET("/keys", h.ListKeys)
+	api.DELETE("/keys/:id", h.RevokeKey)
 
-	// Redirect
+	// Redirect (and the unlock form of password-protected links)
 	r.GET("/:code", h.Redirect)
+	r.POST("/:code", h.Unlock)
 
 	return r
 }
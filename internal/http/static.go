@@ -37,8 +37,8 @@ a{color:#97b3ff}
       <input id="custom" type="text" placeholder="custom alias (optional)"/>
       <button id="go">Shorten</button>
     </div>
-    <small>Optional ISO-8601 expiry (e.g., 2025-12-31T23:59:59Z)</small>
-    <input id="exp" type="text" placeholder="expires_at (optional)"/>
+    <small>Optional expiry: a lifetime (e.g., 72h, P7D) or an ISO-8601 time (e.g., 2025-12-31T23:59:59Z)</small>
+    <input id="exp" type="text" placeholder="ttl or expires_at (optional)"/>
     <div id="out" style="margin-top:1rem"></div>
   </div>
   <p style="opacity:.7;margin-top:1rem">API: <code>POST /api/shorten</code>, <code>GET /:code</code>, <code>GET /api/:code</code></p>
@@ -50,7 +50,8 @@ async function shorten(){
   const exp = document.getElementById('exp').value.trim();
   const body = { url };
   if(custom) body.custom = custom;
-  if(exp) body.expires_at = exp;
+  if(/^(P|\d+(\.\d+)?[a-zµ])/i.test(exp)) body.ttl = exp;
+  else if(exp) body.expires_at = exp;
   const res = await fetch('/api/shorten', {
     method:'POST',
     headers:{'Content-Type':'application/json'},
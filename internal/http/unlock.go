@@ -0,0 +1,106 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"urlshorty/internal/core"
+)
+
+const (
+	// unlockCookie remembers an unlocked protected link. It is scoped to the
+	// link's path, so every code gets its own.
+	unlockCookie = "urlshorty_unlock"
+
+	defaultUnlockTTL = 15 * time.Minute
+)
+
+// Unlock checks the password posted from the unlock form. A correct one sets
+// a signed cookie for the link and redirects back to it; wrong ones show the
+// form again. Attempts are throttled per code and client IP.
+func (h *Handlers) Unlock(c *gin.Context) {
+	code := c.Param("code")
+	if h.unlockLimiter != nil && !h.unlockLimiter.Allow(code+"|"+c.ClientIP()) {
+		h.metrics.rateLimited(c.FullPath())
+		renderUnlock(c, http.StatusTooManyRequests, code, "Too many attempts. Please wait a minute and try again.")
+		return
+	}
+	rec, err := h.svc.Unlock(c.Request.Context(), code, c.PostForm("password"))
+	if err != nil {
+		switch err {
+		case core.ErrWrongPassword:
+			renderUnlock(c, http.StatusForbidden, code, "Wrong password.")
+		case core.ErrInvalidCode:
+			jsonError(c, http.StatusBadRequest, err.Error())
+		case core.ErrNotFound:
+			jsonError(c, http.StatusNotFound, "not found")
+		case core.ErrExpired:
+			jsonError(c, http.StatusGone, "link expired")
+		case core.ErrDisabled, core.ErrQuarantined:
+			renderUnavailable(c, rec)
+		case core.ErrNotYetActive:
+			h.renderScheduled(c, rec)
+		default:
+			jsonError(c, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+	if rec.Protected() {
+		exp := time.Now().Add(h.unlockTTL)
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     unlockCookie,
+			Value:    h.unlockToken(rec, exp),
+			Path:     "/" + rec.Code,
+			Expires:  exp,
+			MaxAge:   int(h.unlockTTL / time.Second),
+			HttpOnly: true,
+			Secure:   strings.HasPrefix(h.baseURL, "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	// See Other turns the POST into a GET of the short link, which now
+	// passes the cookie check and redirects as usual.
+	c.Redirect(http.StatusSeeOther, c.Request.URL.RequestURI())
+}
+
+// unlocked reports whether the request carries a valid, unexpired unlock
+// cookie for rec.
+func (h *Handlers) unlocked(c *gin.Context, rec *core.URL) bool {
+	v, err := c.Cookie(unlockCookie)
+	if err != nil {
+		return false
+	}
+	ts, _, _ := strings.Cut(v, ".")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Now().Unix() >= sec {
+		return false
+	}
+	return hmac.Equal([]byte(v), []byte(h.unlockToken(rec, time.Unix(sec, 0))))
+}
+
+// unlockToken is "<expiry unix>.<mac>". The MAC covers the password hash
+// too, so a link recreated under the same code needs a new unlock.
+func (h *Handlers) unlockToken(rec *core.URL, exp time.Time) string {
+	ts := strconv.FormatInt(exp.Unix(), 10)
+	mac := hmac.New(sha256.New, h.unlockKey)
+	mac.Write([]byte(rec.Code + "\n" + ts + "\n" + rec.PasswordHash))
+	return ts + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// unlockKey returns the configured signing secret or a random per-process one.
+func unlockKey(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return b
+}
@@ -0,0 +1,342 @@
+// Package metrics is a minimal Prometheus text-format registry.
+//
+// It covers what the service needs (labeled counters, labeled histograms and
+// callback counters/gauges) without pulling in the client library. All
+// collector methods are safe on a nil receiver, so instrumented code runs
+// unchanged when metrics are disabled.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are latency buckets in seconds, suited to HTTP handlers
+// and database queries.
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// collector is one metric family.
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families in registration order.
+type Registry struct {
+	mu    sync.Mutex
+	cols  []collector
+	names map[string]bool
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.cols = append(r.cols, c)
+}
+
+// Counter registers a counter family with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, labels}, series: make(map[string]*counterSeries)}
+	r.register(name, c)
+	return c
+}
+
+// Histogram registers a histogram family. buckets must be sorted ascending;
+// nil uses DefaultBuckets.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{desc: desc{name, help, labels}, buckets: buckets, series: make(map[string]*histSeries)}
+	r.register(name, h)
+	return h
+}
+
+// CounterFunc registers an unlabeled counter whose value is read from fn at
+// scrape time (e.g. counters kept by another component).
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcCollector{desc: desc{name: name, help: help}, typ: "counter", fn: fn})
+}
+
+// GaugeFunc registers an unlabeled gauge whose value is read from fn at scrape time.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcCollector{desc: desc{name: name, help: help}, typ: "gauge", fn: fn})
+}
+
+// WriteTo writes every family in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	cols := append([]collector(nil), r.cols...)
+	r.mu.Unlock()
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range cols {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the registry in the text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+// ---- counters ----
+
+// CounterVec is a family of monotonically increasing counters.
+type CounterVec struct {
+	desc
+	mu     sync.RWMutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	n      atomic.Uint64
+}
+
+// Inc adds one to the series identified by labelValues (in label order).
+func (c *CounterVec) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Add adds n to the series identified by labelValues.
+func (c *CounterVec) Add(n uint64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+	c.checkLabels(labelValues)
+	key := strings.Join(labelValues, "\xff")
+	c.mu.RLock()
+	s, ok := c.series[key]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		if s, ok = c.series[key]; !ok {
+			s = &counterSeries{values: append([]string(nil), labelValues...)}
+			c.series[key] = s
+		}
+		c.mu.Unlock()
+	}
+	s.n.Add(n)
+}
+
+// Value returns the current value of a series (0 if it was never touched).
+func (c *CounterVec) Value(labelValues ...string) uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if s, ok := c.series[strings.Join(labelValues, "\xff")]; ok {
+		return s.n.Load()
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.header(w, "counter")
+	c.mu.RLock()
+	keys := sortedKeys(c.series)
+	for _, k := range keys {
+		s := c.series[k]
+		fmt.Fprintf(w, "%s%s %d\n", c.name, labelPairs(c.labels, s.values, "", ""), s.n.Load())
+	}
+	c.mu.RUnlock()
+}
+
+// ---- histograms ----
+
+// HistogramVec is a family of histograms with fixed buckets.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.RWMutex
+	series  map[string]*histSeries
+}
+
+type histSeries struct {
+	values []string
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative; last slot is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Observe records v in the series identified by labelValues.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	h.checkLabels(labelValues)
+	key := strings.Join(labelValues, "\xff")
+	h.mu.RLock()
+	s, ok := h.series[key]
+	h.mu.RUnlock()
+	if !ok {
+		h.mu.Lock()
+		if s, ok = h.series[key]; !ok {
+			s = &histSeries{values: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets)+1)}
+			h.series[key] = s
+		}
+		h.mu.Unlock()
+	}
+	i := sort.SearchFloat64s(h.buckets, v) // first bucket with upper bound >= v
+	s.mu.Lock()
+	s.counts[i]++
+	s.sum += v
+	s.count++
+	s.mu.Unlock()
+}
+
+// ObserveSince records the seconds elapsed since start.
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Count returns the number of observations in a series.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	if h == nil {
+		return 0
+	}
+	h.mu.RLock()
+	s, ok := h.series[strings.Join(labelValues, "\xff")]
+	h.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.header(w, "histogram")
+	h.mu.RLock()
+	keys := sortedKeys(h.series)
+	for _, k := range keys {
+		s := h.series[k]
+		s.mu.Lock()
+		var cum uint64
+		for i, ub := range h.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, s.values, "le", formatFloat(ub)), cum)
+		}
+		cum += s.counts[len(h.buckets)]
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, s.values, "le", "+Inf"), cum)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelPairs(h.labels, s.values, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelPairs(h.labels, s.values, "", ""), s.count)
+		s.mu.Unlock()
+	}
+	h.mu.RUnlock()
+}
+
+// ---- callback collectors ----
+
+type funcCollector struct {
+	desc
+	typ string
+	fn  func() float64
+}
+
+func (f *funcCollector) write(w *bufio.Writer) {
+	f.header(w, f.typ)
+	fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+}
+
+// ---- helpers ----
+
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d *desc) header(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, typ)
+}
+
+func (d *desc) checkLabels(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelPairs renders {k="v",...}, optionally with one extra pair appended.
+func labelPairs(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, n, labelEscaper.Replace(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, extraName, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
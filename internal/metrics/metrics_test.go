@@ -0,0 +1,54 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	"urlshorty/internal/metrics"
+)
+
+func TestRegistry_TextFormat(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := reg.Counter("test_requests_total", "Requests.", "route")
+	h := reg.Histogram("test_latency_seconds", "Latency.", []float64{0.1, 1}, "op")
+	reg.GaugeFunc("test_queue_length", "Queue.", func() float64 { return 3 })
+
+	c.Inc(`/a"b`)
+	c.Add(2, "/c")
+	h.Observe(0.05, "find")
+	h.Observe(0.5, "find")
+	h.Observe(5, "find")
+
+	var b strings.Builder
+	if _, err := reg.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	want := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{route="/a\"b"} 1
+test_requests_total{route="/c"} 2
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{op="find",le="0.1"} 1
+test_latency_seconds_bucket{op="find",le="1"} 2
+test_latency_seconds_bucket{op="find",le="+Inf"} 3
+test_latency_seconds_sum{op="find"} 5.55
+test_latency_seconds_count{op="find"} 3
+# HELP test_queue_length Queue.
+# TYPE test_queue_length gauge
+test_queue_length 3
+`
+	if got := b.String(); got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNilCollectorsAreNoops(t *testing.T) {
+	var c *metrics.CounterVec
+	var h *metrics.HistogramVec
+	c.Inc("x")
+	h.Observe(1, "x")
+	if c.Value("x") != 0 || h.Count("x") != 0 {
+		t.Fatal("nil collectors should report zero")
+	}
+}
@@ -33,18 +33,42 @@ func NewLimiter(rps, burst int) *Limiter {
 	}
 }
 
+// NewLimiterEvery creates a limiter that refills one token per interval,
+// for rates below one per second.
+func NewLimiterEvery(interval time.Duration, burst int) *Limiter {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &Limiter{
+		rps:    1 / interval.Seconds(),
+		burst:  float64(burst),
+		bucket: make(map[string]*tb),
+	}
+}
+
 // Allow consumes one token for key if available and returns true.
 // Otherwise returns false.
 func (l *Limiter) Allow(key string) bool {
+	return l.AllowN(key, 1)
+}
+
+// AllowN consumes n tokens for key if available and returns true. A cost
+// above the burst is allowed only when the bucket is full and leaves it in
+// debt, so large requests wait proportionally long before the next one.
+func (l *Limiter) AllowN(key string, n int) bool {
 	now := time.Now()
+	cost := float64(n)
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	b, ok := l.bucket[key]
 	if !ok {
-		l.bucket[key] = &tb{tokens: l.burst - 1, last: now}
-		return true
+		b = &tb{tokens: l.burst, last: now}
+		l.bucket[key] = b
 	}
 
 	// Refill based on elapsed time
@@ -54,8 +78,8 @@ func (l *Limiter) Allow(key string) bool {
 		b.last = now
 	}
 
-	if b.tokens >= 1.0 {
-		b.tokens -= 1.0
+	if b.tokens >= min(cost, l.burst) {
+		b.tokens -= cost
 		return true
 	}
 	return false
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"urlshorty/internal/core"
+)
+
+// CreateAPIKey stores a key with its secret hash and sets k.ID.
+func (s *Store) CreateAPIKey(_ context.Context, k *core.APIKey, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.keys {
+		if r.Hash == hash {
+			return core.ErrConflict
+		}
+	}
+	s.nextKeyID++
+	k.ID = s.nextKeyID
+	r := &keyRecord{APIKey: *k, Hash: hash}
+	r.CreatedAt = k.CreatedAt.UTC()
+	r.RevokedAt = cloneTime(k.RevokedAt)
+	s.keys = append(s.keys, r)
+	return nil
+}
+
+// FindAPIKeyByHash returns the key whose secret hashes to hash (revoked included).
+func (s *Store) FindAPIKeyByHash(_ context.Context, hash string) (*core.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.keys {
+		if r.Hash == hash {
+			return cloneKey(r), nil
+		}
+	}
+	return nil, core.ErrNotFound
+}
+
+// ListAPIKeys returns every key ordered by ID.
+func (s *Store) ListAPIKeys(_ context.Context) ([]*core.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*core.APIKey, 0, len(s.keys))
+	for _, r := range s.keys {
+		out = append(out, cloneKey(r))
+	}
+	return out, nil
+}
+
+// RevokeAPIKey sets RevokedAt for id (keeping the first revocation time).
+func (s *Store) RevokeAPIKey(_ context.Context, id int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.keys {
+		if r.ID == id {
+			if r.RevokedAt == nil {
+				r.RevokedAt = cloneTime(&at)
+			}
+			return nil
+		}
+	}
+	return core.ErrNotFound
+}
+
+func cloneKey(r *keyRecord) *core.APIKey {
+	k := r.APIKey
+	k.RevokedAt = cloneTime(r.RevokedAt)
+	return &k
+}
+
+// Compile-time check: *Store implements core.KeyStore.
+var _ core.KeyStore = (*Store)(nil)
@@ -0,0 +1,320 @@
+// Package memory implements core.Store in process memory.
+//
+// It is meant for tests and throwaway preview deployments: everything lives
+// in maps guarded by one RWMutex, and state is lost on exit unless the store
+// was opened with a snapshot path (see Open).
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"urlshorty/internal/core"
+)
+
+// Store implements core.Store and core.KeyStore in memory.
+type Store struct {
+	mu sync.RWMutex
+
+	urls      map[string]*core.URL // by code
+	clicks    map[string][]core.ClickEvent
+	keys      []*keyRecord // ordered by ID
+	nextURLID int64
+	nextKeyID int64
+
+	snapshot string // file written on Close ("" = no persistence)
+}
+
+type keyRecord struct {
+	core.APIKey
+	Hash string `json:"hash"`
+}
+
+// New returns an empty store without persistence.
+func New() *Store {
+	return &Store{
+		urls:   make(map[string]*core.URL),
+		clicks: make(map[string][]core.ClickEvent),
+	}
+}
+
+// Create inserts a copy of u and sets u.ID. Returns core.ErrConflict if the
+// code already exists.
+func (s *Store) Create(_ context.Context, u *core.URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.urls[u.Code]; ok {
+		return core.ErrConflict
+	}
+	s.nextURLID++
+	u.ID = s.nextURLID
+	rec := cloneURL(u)
+	rec.Hits, rec.UsedHits = 0, 0
+	rec.Status = u.LinkStatus()
+	s.urls[u.Code] = rec
+	return nil
+}
+
+// CreateBatch inserts copies of recs under one lock, so readers see all of
+// them or none. Taken codes, including ones repeated within recs, are
+// reported as core.ErrConflict; with atomic set nothing is inserted then.
+func (s *Store) CreateBatch(_ context.Context, recs []*core.URL, atomic bool) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := make([]error, len(recs))
+	seen := make(map[string]bool, len(recs))
+	failed := false
+	for i, u := range recs {
+		if _, ok := s.urls[u.Code]; ok || seen[u.Code] {
+			errs[i], failed = core.ErrConflict, true
+		}
+		seen[u.Code] = true
+	}
+	if atomic && failed {
+		return errs, nil
+	}
+	for i, u := range recs {
+		if errs[i] != nil {
+			continue
+		}
+		s.nextURLID++
+		u.ID = s.nextURLID
+		rec := cloneURL(u)
+		rec.Hits, rec.UsedHits = 0, 0
+		rec.Status = u.LinkStatus()
+		s.urls[u.Code] = rec
+	}
+	return errs, nil
+}
+
+// FindByCode returns a copy of the record for code (expired included).
+func (s *Store) FindByCode(_ context.Context, code string) (*core.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.urls[code]
+	if !ok {
+		return nil, core.ErrNotFound
+	}
+	return cloneURL(rec), nil
+}
+
+// FindByLongURL returns the newest live link to q.LongURL for the owner and
+// redirect type in q, or core.ErrNotFound.
+func (s *Store) FindByLongURL(_ context.Context, q core.LongURLQuery) (*core.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var best *core.URL
+	for _, rec := range s.urls {
+		if rec.LongURL != q.LongURL || rec.OwnerID != q.OwnerID || rec.RedirectType != q.RedirectType {
+			continue
+		}
+		if rec.ArchivedAt != nil || rec.LinkStatus() != core.StatusActive || rec.Protected() || rec.MaxHits > 0 || (rec.ExpiresAt != nil && !rec.ExpiresAt.After(q.Now)) {
+			continue
+		}
+		if best == nil || rec.ID > best.ID {
+			best = rec
+		}
+	}
+	if best == nil {
+		return nil, core.ErrNotFound
+	}
+	return cloneURL(best), nil
+}
+
+// Update overwrites the mutable fields of the record with u.Code.
+func (s *Store) Update(_ context.Context, u *core.URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.urls[u.Code]
+	if !ok {
+		return core.ErrNotFound
+	}
+	rec.LongURL = u.LongURL
+	rec.ExpiresAt = cloneTime(u.ExpiresAt)
+	rec.StartsAt = cloneTime(u.StartsAt)
+	rec.ArchivedAt = cloneTime(u.ArchivedAt)
+	rec.RedirectType = u.RedirectType
+	rec.Status = u.LinkStatus()
+	rec.StatusReason = u.StatusReason
+	rec.StatusChangedAt = cloneTime(u.StatusChangedAt)
+	return nil
+}
+
+// Delete removes the record for code together with its clicks.
+func (s *Store) Delete(_ context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.urls[code]; !ok {
+		return core.ErrNotFound
+	}
+	delete(s.urls, code)
+	delete(s.clicks, code)
+	return nil
+}
+
+// List returns up to q.Limit records, newest (highest ID) first.
+func (s *Store) List(_ context.Context, q core.ListQuery) ([]*core.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*core.URL
+	for _, rec := range s.urls {
+		if q.BeforeID > 0 && rec.ID >= q.BeforeID {
+			continue
+		}
+		if q.OwnerID != 0 && rec.OwnerID != q.OwnerID {
+			continue
+		}
+		out = append(out, rec)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	if q.Limit >= 0 && len(out) > q.Limit {
+		out = out[:q.Limit]
+	}
+	for i, rec := range out {
+		out[i] = cloneURL(rec)
+	}
+	return out, nil
+}
+
+// IncrementHits increases the hits counter for code.
+func (s *Store) IncrementHits(_ context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.urls[code]
+	if !ok {
+		return core.ErrNotFound
+	}
+	rec.Hits++
+	return nil
+}
+
+// ConsumeHit counts one redirect against the link's MaxHits.
+func (s *Store) ConsumeHit(_ context.Context, code string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.urls[code]
+	if !ok || rec.Exhausted() {
+		return false, nil
+	}
+	rec.UsedHits++
+	return true, nil
+}
+
+// PurgeExpired deletes expired links and returns how many were removed.
+func (s *Store) PurgeExpired(_ context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for code, rec := range s.urls {
+		if rec.ExpiresAt != nil && !rec.ExpiresAt.After(now) {
+			delete(s.urls, code)
+			delete(s.clicks, code)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ArchiveExpired marks links expired at or before cutoff as archived at now
+// and returns the number of newly archived links.
+func (s *Store) ArchiveExpired(_ context.Context, cutoff, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, rec := range s.urls {
+		if rec.ExpiresAt != nil && !rec.ExpiresAt.After(cutoff) && rec.ArchivedAt == nil {
+			rec.ArchivedAt = cloneTime(&now)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// RecordClicks stores click events and bumps hits counters. Events for codes
+// that no longer exist are skipped.
+func (s *Store) RecordClicks(_ context.Context, evs []core.ClickEvent) error {
+	if len(evs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ev := range evs {
+		rec, ok := s.urls[ev.Code]
+		if !ok {
+			continue
+		}
+		rec.Hits++
+		ev.At = ev.At.UTC()
+		s.clicks[ev.Code] = append(s.clicks[ev.Code], ev)
+	}
+	return nil
+}
+
+// ClickStats aggregates clicks for code into buckets and top referrers.
+func (s *Store) ClickStats(_ context.Context, code string, q core.StatsQuery) (*core.ClickStats, error) {
+	width := int64(core.BucketDuration(q.Bucket) / time.Second)
+	if width <= 0 {
+		return nil, core.ErrInvalidStats
+	}
+	from, to := q.From.Unix(), q.To.Unix()
+
+	s.mu.RLock()
+	buckets := make(map[int64]int64)
+	refs := make(map[string]int64)
+	for _, ev := range s.clicks[code] {
+		at := ev.At.Unix()
+		if at < from || at >= to {
+			continue
+		}
+		buckets[at/width*width]++
+		refs[ev.Referrer]++
+	}
+	s.mu.RUnlock()
+
+	st := &core.ClickStats{}
+	for start, n := range buckets {
+		st.Series = append(st.Series, core.BucketCount{Start: time.Unix(start, 0).UTC(), Count: n})
+		st.Total += n
+	}
+	sort.Slice(st.Series, func(i, j int) bool { return st.Series[i].Start.Before(st.Series[j].Start) })
+
+	for ref, n := range refs {
+		st.TopReferrers = append(st.TopReferrers, core.ReferrerCount{Referrer: ref, Count: n})
+	}
+	sort.Slice(st.TopReferrers, func(i, j int) bool {
+		a, b := st.TopReferrers[i], st.TopReferrers[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Referrer < b.Referrer
+	})
+	if q.TopN >= 0 && len(st.TopReferrers) > q.TopN {
+		st.TopReferrers = st.TopReferrers[:q.TopN]
+	}
+	return st, nil
+}
+
+// cloneURL copies u so callers never share memory with the store.
+func cloneURL(u *core.URL) *core.URL {
+	c := *u
+	c.CreatedAt = u.CreatedAt.UTC()
+	c.ExpiresAt = cloneTime(u.ExpiresAt)
+	c.StartsAt = cloneTime(u.StartsAt)
+	c.ArchivedAt = cloneTime(u.ArchivedAt)
+	c.StatusChangedAt = cloneTime(u.StatusChangedAt)
+	return &c
+}
+
+// cloneTime copies an optional time, normalized to UTC.
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := t.UTC()
+	return &c
+}
+
+// Compile-time check: *Store implements core.Store and every optional capability.
+var _ core.FullStore = (*Store)(nil)
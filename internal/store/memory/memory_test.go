@@ -0,0 +1,62 @@
+package memory_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"urlshorty/internal/core"
+	"urlshorty/internal/store/memory"
+	"urlshorty/internal/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) core.Store { return memory.New() })
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "snap", "urlshorty.json")
+	now := time.Now().UTC()
+
+	st, err := memory.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := st.Create(ctx, &core.URL{Code: "keep", LongURL: "https://example.com", CreatedAt: now, ExpiresAt: &now}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := st.RecordClicks(ctx, []core.ClickEvent{{Code: "keep", At: now, Referrer: "a.example"}}); err != nil {
+		t.Fatalf("RecordClicks: %v", err)
+	}
+	if err := st.CreateAPIKey(ctx, &core.APIKey{Name: "ci", CreatedAt: now}, "hash"); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	st, err = memory.Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	rec, err := st.FindByCode(ctx, "keep")
+	if err != nil || rec.Hits != 1 || !rec.ExpiresAt.Equal(now) {
+		t.Fatalf("restored record: %+v err=%v", rec, err)
+	}
+	if _, err := st.FindAPIKeyByHash(ctx, "hash"); err != nil {
+		t.Fatalf("restored key: %v", err)
+	}
+	// IDs continue after the restored ones.
+	u := &core.URL{Code: "next", LongURL: "https://example.com", CreatedAt: now}
+	if err := st.Create(ctx, u); err != nil || u.ID != rec.ID+1 {
+		t.Fatalf("Create after restore: id=%d err=%v", u.ID, err)
+	}
+	stats, err := st.ClickStats(ctx, "keep", core.StatsQuery{
+		Bucket: core.BucketDay, From: now.Add(-time.Hour), To: now.Add(time.Hour), TopN: 5,
+	})
+	if err != nil || stats.Total != 1 {
+		t.Fatalf("restored clicks: %+v err=%v", stats, err)
+	}
+}
@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"urlshorty/internal/core"
+)
+
+const snapshotVersion = 1
+
+// snapshotFile is the on-disk JSON form of a Store.
+type snapshotFile struct {
+	Version   int                          `json:"version"`
+	NextURLID int64                        `json:"next_url_id"`
+	NextKeyID int64                        `json:"next_key_id"`
+	URLs      []*core.URL                  `json:"urls"`
+	Clicks    map[string][]core.ClickEvent `json:"clicks,omitempty"`
+	Keys      []*keyRecord                 `json:"keys,omitempty"`
+}
+
+// Open returns a store persisted to path: the snapshot is loaded if the file
+// exists and rewritten on Close. An empty path behaves like New.
+func Open(path string) (*Store, error) {
+	s := New()
+	s.snapshot = path
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap snapshotFile
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("memory: read snapshot %s: %w", path, err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("memory: snapshot %s has unsupported version %d", path, snap.Version)
+	}
+	for _, u := range snap.URLs {
+		s.urls[u.Code] = u
+	}
+	for code, evs := range snap.Clicks {
+		s.clicks[code] = evs
+	}
+	s.keys = snap.Keys
+	s.nextURLID, s.nextKeyID = snap.NextURLID, snap.NextKeyID
+	return s, nil
+}
+
+// Save writes the current state to the snapshot path, if one is set.
+// The file is replaced atomically so a crash never leaves it half-written.
+func (s *Store) Save() error {
+	if s.snapshot == "" {
+		return nil
+	}
+	s.mu.RLock()
+	snap := snapshotFile{
+		Version:   snapshotVersion,
+		NextURLID: s.nextURLID,
+		NextKeyID: s.nextKeyID,
+		URLs:      make([]*core.URL, 0, len(s.urls)),
+		Clicks:    s.clicks,
+		Keys:      s.keys,
+	}
+	for _, u := range s.urls {
+		snap.URLs = append(snap.URLs, u)
+	}
+	data, err := json.Marshal(snap)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.snapshot)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.snapshot)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.snapshot)
+}
+
+// Close writes the snapshot (when persistence is enabled).
+func (s *Store) Close() error { return s.Save() }
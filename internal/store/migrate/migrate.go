@@ -0,0 +1,347 @@
+// Package migrate applies numbered, embedded SQL migrations and records them
+// in a schema_migrations table.
+//
+// Migrations are files named NNNN_name.up.sql with an optional matching
+// NNNN_name.down.sql. Each migration runs in its own transaction together
+// with its bookkeeping row, and the checksum of every applied up-script is
+// verified before anything new is applied.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrChecksumMismatch means an applied migration file was edited afterwards.
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+	// ErrUnknownVersion means the database has a migration this binary doesn't know.
+	ErrUnknownVersion = errors.New("database has unknown migration")
+	// ErrNoDown means a migration cannot be reverted.
+	ErrNoDown = errors.New("migration has no down script")
+)
+
+var fileRe = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // hex SHA-256 of Up
+}
+
+// Status describes a migration relative to the database.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // applied, but the file's checksum differs from the recorded one
+}
+
+// Options adapts the migrator to a SQL dialect.
+type Options struct {
+	// Placeholder returns the bind parameter for the n-th (1-based) argument.
+	// Defaults to "?".
+	Placeholder func(n int) string
+	// Lock, if set, runs first in every migration transaction to serialize
+	// concurrent migrators (e.g. "SELECT pg_advisory_xact_lock(42)").
+	Lock string
+}
+
+// Migrator applies migrations from a filesystem to a database.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	ph         func(int) string
+	lock       string
+}
+
+// New loads migrations from dir in fsys.
+func New(db *sql.DB, fsys fs.FS, dir string, opts Options) (*Migrator, error) {
+	ms, err := Load(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	ph := opts.Placeholder
+	if ph == nil {
+		ph = func(int) string { return "?" }
+	}
+	return &Migrator{db: db, migrations: ms, ph: ph, lock: opts.Lock}, nil
+}
+
+// Load reads and validates migration files from dir, sorted by version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := fileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %04d has conflicting names %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if strings.TrimSpace(mig.Up) == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", mig.Version, mig.Name)
+		}
+		sum := sha256.Sum256([]byte(mig.Up))
+		mig.Checksum = hex.EncodeToString(sum[:])
+		out = append(out, *mig)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Migrations returns the known migrations, oldest first.
+func (m *Migrator) Migrations() []Migration { return m.migrations }
+
+// Up applies all pending migrations in order and returns the ones applied.
+// It refuses to run if an applied migration was modified or is unknown.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verify(applied); err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		ran, err := m.apply(ctx, mig)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, mig)
+		}
+	}
+	return done, nil
+}
+
+// Down reverts the newest steps applied migrations and returns the ones reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verify(applied); err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if strings.TrimSpace(mig.Down) == "" {
+			return done, fmt.Errorf("%04d_%s: %w", mig.Version, mig.Name, ErrNoDown)
+		}
+		if err := m.revert(ctx, mig); err != nil {
+			return done, err
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Baseline records every migration up to and including version as applied
+// without running it. It is meant for adopting databases whose schema was
+// created before migrations were tracked; already-recorded versions are kept.
+func (m *Migrator) Baseline(ctx context.Context, version int) error {
+	if err := m.ensureTable(ctx); err != nil {
+		return err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	return m.inTx(ctx, func(tx *sql.Tx) error {
+		for _, mig := range m.migrations {
+			if mig.Version > version {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.record(ctx, tx, mig); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status reports every known migration and whether it is applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := Status{Migration: mig}
+		if rec, ok := applied[mig.Version]; ok {
+			st.Applied = true
+			st.AppliedAt = rec.appliedAt
+			st.Modified = rec.checksum != mig.Checksum
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// ---- internals ----
+
+type appliedRow struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version    INTEGER   PRIMARY KEY,
+  name       TEXT      NOT NULL,
+  checksum   TEXT      NOT NULL,
+  applied_at TIMESTAMP NOT NULL
+);`)
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]appliedRow, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT version, checksum, applied_at FROM schema_migrations;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[int]appliedRow)
+	for rows.Next() {
+		var v int
+		var r appliedRow
+		if err := rows.Scan(&v, &r.checksum, &r.appliedAt); err != nil {
+			return nil, err
+		}
+		out[v] = r
+	}
+	return out, rows.Err()
+}
+
+func (m *Migrator) verify(applied map[int]appliedRow) error {
+	known := make(map[int]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	for v, rec := range applied {
+		mig, ok := known[v]
+		if !ok {
+			return fmt.Errorf("version %d: %w", v, ErrUnknownVersion)
+		}
+		if rec.checksum != mig.Checksum {
+			return fmt.Errorf("%04d_%s: %w", mig.Version, mig.Name, ErrChecksumMismatch)
+		}
+	}
+	return nil
+}
+
+// apply runs mig unless another migrator applied it since applied() was read.
+func (m *Migrator) apply(ctx context.Context, mig Migration) (bool, error) {
+	ran := false
+	err := m.inTx(ctx, func(tx *sql.Tx) error {
+		var n int
+		q := fmt.Sprintf(`SELECT COUNT(*) FROM schema_migrations WHERE version = %s;`, m.ph(1))
+		if err := tx.QueryRowContext(ctx, q, mig.Version).Scan(&n); err != nil || n > 0 {
+			return err
+		}
+		ran = true
+		if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+			return fmt.Errorf("apply %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		return m.record(ctx, tx, mig)
+	})
+	return ran && err == nil, err
+}
+
+func (m *Migrator) record(ctx context.Context, tx *sql.Tx, mig Migration) error {
+	q := fmt.Sprintf(`INSERT INTO schema_migrations(version, name, checksum, applied_at) VALUES (%s, %s, %s, %s);`,
+		m.ph(1), m.ph(2), m.ph(3), m.ph(4))
+	_, err := tx.ExecContext(ctx, q, mig.Version, mig.Name, mig.Checksum, time.Now().UTC())
+	return err
+}
+
+func (m *Migrator) revert(ctx context.Context, mig Migration) error {
+	return m.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+			return fmt.Errorf("revert %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		q := fmt.Sprintf(`DELETE FROM schema_migrations WHERE version = %s;`, m.ph(1))
+		_, err := tx.ExecContext(ctx, q, mig.Version)
+		return err
+	})
+}
+
+func (m *Migrator) inTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if m.lock != "" {
+		if _, err := tx.ExecContext(ctx, m.lock); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,119 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+
+	"urlshorty/internal/store/migrate"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"m/0001_a.up.sql":   {Data: []byte(`CREATE TABLE a (id INTEGER);`)},
+		"m/0001_a.down.sql": {Data: []byte(`DROP TABLE a;`)},
+		"m/0002_b.up.sql":   {Data: []byte(`CREATE TABLE b (id INTEGER);`)},
+		"m/0002_b.down.sql": {Data: []byte(`DROP TABLE b;`)},
+		"m/README.md":       {Data: []byte(`ignored`)},
+	}
+}
+
+func TestMigrator_UpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	m, err := migrate.New(db, testFS(), "m", migrate.Options{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("Up: applied=%d err=%v", len(applied), err)
+	}
+	if applied, _ := m.Up(ctx); len(applied) != 0 {
+		t.Fatalf("second Up applied %d migrations", len(applied))
+	}
+
+	reverted, err := m.Down(ctx, 1)
+	if err != nil || len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Fatalf("Down: reverted=%v err=%v", reverted, err)
+	}
+	if _, err := db.Exec(`SELECT * FROM b`); err == nil {
+		t.Fatal("table b should be dropped")
+	}
+
+	st, err := m.Status(ctx)
+	if err != nil || len(st) != 2 || !st[0].Applied || st[1].Applied {
+		t.Fatalf("Status: %+v err=%v", st, err)
+	}
+}
+
+func TestMigrator_FailedMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	fsys := testFS()
+	fsys["m/0002_b.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE b (id INTEGER); SELECT * FROM missing;`)}
+	m, _ := migrate.New(db, fsys, "m", migrate.Options{})
+
+	if _, err := m.Up(ctx); err == nil {
+		t.Fatal("expected Up to fail")
+	}
+	if _, err := db.Exec(`SELECT * FROM b`); err == nil {
+		t.Fatal("failed migration left table b behind")
+	}
+	st, _ := m.Status(ctx)
+	if !st[0].Applied || st[1].Applied {
+		t.Fatalf("unexpected status after failure: %+v", st)
+	}
+}
+
+func TestMigrator_ChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	m, _ := migrate.New(db, testFS(), "m", migrate.Options{})
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	edited := testFS()
+	edited["m/0001_a.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE a (id INTEGER, x TEXT);`)}
+	edited["m/0003_c.up.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE c (id INTEGER);`)}
+	m2, _ := migrate.New(db, edited, "m", migrate.Options{})
+	if _, err := m2.Up(ctx); !errors.Is(err, migrate.ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := db.Exec(`SELECT * FROM c`); err == nil {
+		t.Fatal("nothing should be applied after a checksum mismatch")
+	}
+}
+
+func TestMigrator_Baseline(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	if _, err := db.Exec(`CREATE TABLE a (id INTEGER);`); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := migrate.New(db, testFS(), "m", migrate.Options{})
+	if err := m.Baseline(ctx, 1); err != nil {
+		t.Fatalf("Baseline: %v", err)
+	}
+	applied, err := m.Up(ctx)
+	if err != nil || len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("Up after baseline: applied=%v err=%v", applied, err)
+	}
+}
@@ -0,0 +1,21 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"strconv"
+
+	"urlshorty/internal/store/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// NewMigrator returns the migration runner for the embedded PostgreSQL schema.
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	return migrate.New(db, migrationFS, "migrations", migrate.Options{
+		Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		// Replicas may start together; serialize their migration transactions.
+		Lock: `SELECT pg_advisory_xact_lock(7262871)`,
+	})
+}
@@ -0,0 +1,36 @@
+-- API keys; only a SHA-256 of the secret is stored.
+CREATE TABLE api_keys (
+  id         BIGSERIAL   PRIMARY KEY,
+  name       TEXT        NOT NULL,
+  key_hash   TEXT        NOT NULL UNIQUE,
+  admin      BOOLEAN     NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ NULL
+);
+
+CREATE TABLE urls (
+  id          BIGSERIAL   PRIMARY KEY,
+  code        TEXT        NOT NULL UNIQUE,
+  long_url    TEXT        NOT NULL,
+  created_at  TIMESTAMPTZ NOT NULL,
+  expires_at  TIMESTAMPTZ NULL,
+  hits        BIGINT      NOT NULL DEFAULT 0,
+  archived_at TIMESTAMPTZ NULL,
+  owner_id    BIGINT      NULL REFERENCES api_keys(id)
+);
+
+CREATE INDEX idx_urls_expires_at ON urls(expires_at);
+CREATE INDEX idx_urls_owner_id ON urls(owner_id);
+
+-- One row per redirect. "at" is unix seconds (UTC) so buckets are plain integer math.
+CREATE TABLE clicks (
+  id         BIGSERIAL PRIMARY KEY,
+  code       TEXT      NOT NULL REFERENCES urls(code) ON DELETE CASCADE,
+  at         BIGINT    NOT NULL,
+  referrer   TEXT      NOT NULL DEFAULT '',
+  user_agent TEXT      NOT NULL DEFAULT '',
+  ip_hash    TEXT      NOT NULL DEFAULT '',
+  country    TEXT      NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_clicks_code_at ON clicks(code, at);
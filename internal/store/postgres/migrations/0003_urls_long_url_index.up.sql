@@ -0,0 +1,2 @@
+-- Dedupe lookups (DEDUPE=true) search by destination.
+CREATE INDEX idx_urls_long_url ON urls(long_url);
@@ -0,0 +1,3 @@
+ALTER TABLE urls DROP COLUMN status_changed_at;
+ALTER TABLE urls DROP COLUMN status_reason;
+ALTER TABLE urls DROP COLUMN status;
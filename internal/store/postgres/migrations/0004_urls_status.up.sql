@@ -0,0 +1,4 @@
+-- Admin takedowns: 'active', 'disabled' or 'quarantined', with reason and time.
+ALTER TABLE urls ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE urls ADD COLUMN status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN status_changed_at TIMESTAMPTZ NULL;
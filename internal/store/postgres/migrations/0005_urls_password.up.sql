@@ -0,0 +1,2 @@
+-- bcrypt hash of the link password; '' = no password.
+ALTER TABLE urls ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
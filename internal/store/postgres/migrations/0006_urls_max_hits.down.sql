@@ -0,0 +1,2 @@
+ALTER TABLE urls DROP COLUMN used_hits;
+ALTER TABLE urls DROP COLUMN max_hits;
@@ -0,0 +1,3 @@
+-- Redirect cap: max_hits (0 = unlimited) and the exact count used against it.
+ALTER TABLE urls ADD COLUMN max_hits BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN used_hits BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,422 @@
+// Package postgres implements core.Store on PostgreSQL, for running several
+// replicas against one shared database.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"urlshorty/internal/core"
+)
+
+// SQLSTATE codes we map to core errors.
+const uniqueViolation = "23505"
+
+// Store implements core.Store backed by PostgreSQL.
+type Store struct {
+	db *sql.DB
+}
+
+// Open connects to the database at dsn (a postgres:// URL or key=value string)
+// and applies migrations.
+func Open(dsn string) (*Store, error) {
+	db, err := OpenDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	m, err := NewMigrator(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if _, err := m.Up(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// OpenDB opens a connection pool without applying migrations (see NewMigrator).
+func OpenDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(20)
+	db.SetMaxIdleConns(10)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+	return db, nil
+}
+
+// Close releases the underlying pool.
+func (s *Store) Close() error { return s.db.Close() }
+
+// Create inserts a new URL record. Returns core.ErrConflict if code already exists.
+func (s *Store) Create(ctx context.Context, u *core.URL) error {
+	const q = `
+INSERT INTO urls(code, long_url, created_at, expires_at, hits, owner_id, redirect_type,
+                 status, status_reason, status_changed_at, password_hash, max_hits, starts_at)
+VALUES ($1, $2, $3, $4, 0, $5, $6, $7, $8, $9, $10, $11, $12)
+RETURNING id;`
+	err := s.db.QueryRowContext(ctx, q, u.Code, u.LongURL, u.CreatedAt.UTC(),
+		nullableTime(u.ExpiresAt), nullableID(u.OwnerID), u.RedirectType,
+		u.LinkStatus(), u.StatusReason, nullableTime(u.StatusChangedAt), u.PasswordHash, u.MaxHits, nullableTime(u.StartsAt)).Scan(&u.ID)
+	if isUniqueViolation(err) {
+		return core.ErrConflict
+	}
+	return err
+}
+
+// CreateBatch inserts recs in one transaction. Taken codes are skipped by
+// ON CONFLICT and reported as core.ErrConflict; with atomic set, the
+// transaction is rolled back if there are any.
+func (s *Store) CreateBatch(ctx context.Context, recs []*core.URL, atomic bool) ([]error, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const q = `
+INSERT INTO urls(code, long_url, created_at, expires_at, hits, owner_id, redirect_type,
+                 status, status_reason, status_changed_at, password_hash, max_hits, starts_at)
+VALUES ($1, $2, $3, $4, 0, $5, $6, $7, $8, $9, $10, $11, $12)
+ON CONFLICT (code) DO NOTHING
+RETURNING id;`
+	stmt, err := tx.PrepareContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	errs := make([]error, len(recs))
+	failed := false
+	for i, u := range recs {
+		err := stmt.QueryRowContext(ctx, u.Code, u.LongURL, u.CreatedAt.UTC(),
+			nullableTime(u.ExpiresAt), nullableID(u.OwnerID), u.RedirectType,
+			u.LinkStatus(), u.StatusReason, nullableTime(u.StatusChangedAt), u.PasswordHash, u.MaxHits, nullableTime(u.StartsAt)).Scan(&u.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			errs[i], failed = core.ErrConflict, true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if atomic && failed {
+		return errs, nil
+	}
+	return errs, tx.Commit()
+}
+
+// urlColumns is the column list scanURL expects, in order.
+const urlColumns = `id, code, long_url, created_at, expires_at, hits, archived_at, owner_id, redirect_type,
+status, status_reason, status_changed_at, password_hash, max_hits, used_hits, starts_at`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanURL(row rowScanner) (*core.URL, error) {
+	var rec core.URL
+	var created time.Time
+	var expires, archived, statusChanged, starts sql.NullTime
+	var owner sql.NullInt64
+
+	if err := row.Scan(&rec.ID, &rec.Code, &rec.LongURL, &created, &expires, &rec.Hits, &archived, &owner, &rec.RedirectType,
+		&rec.Status, &rec.StatusReason, &statusChanged, &rec.PasswordHash, &rec.MaxHits, &rec.UsedHits, &starts); err != nil {
+		return nil, err
+	}
+	rec.OwnerID = owner.Int64
+	rec.CreatedAt = created.UTC()
+	if expires.Valid {
+		t := expires.Time.UTC()
+		rec.ExpiresAt = &t
+	}
+	if starts.Valid {
+		t := starts.Time.UTC()
+		rec.StartsAt = &t
+	}
+	if archived.Valid {
+		t := archived.Time.UTC()
+		rec.ArchivedAt = &t
+	}
+	if statusChanged.Valid {
+		t := statusChanged.Time.UTC()
+		rec.StatusChangedAt = &t
+	}
+	return &rec, nil
+}
+
+// nullableTime converts an optional time to a driver value (UTC or NULL).
+func nullableTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// nullableID maps the zero ID to NULL.
+func nullableID(id int64) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique_violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// FindByCode returns a URL record for the given code (expired included).
+func (s *Store) FindByCode(ctx context.Context, code string) (*core.URL, error) {
+	q := `SELECT ` + urlColumns + ` FROM urls WHERE code = $1;`
+	rec, err := scanURL(s.db.QueryRowContext(ctx, q, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, core.ErrNotFound
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+// FindByLongURL returns the newest live link to q.LongURL for the owner and
+// redirect type in q, or core.ErrNotFound.
+func (s *Store) FindByLongURL(ctx context.Context, q core.LongURLQuery) (*core.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls
+WHERE long_url = $1 AND owner_id IS NOT DISTINCT FROM $2 AND redirect_type = $3 AND status = 'active' AND password_hash = '' AND max_hits = 0
+  AND archived_at IS NULL AND (expires_at IS NULL OR expires_at > $4)
+ORDER BY id DESC LIMIT 1;`
+	rec, err := scanURL(s.db.QueryRowContext(ctx, query, q.LongURL, nullableID(q.OwnerID), q.RedirectType, q.Now.UTC()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, core.ErrNotFound
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Update overwrites the mutable fields of the record with u.Code.
+func (s *Store) Update(ctx context.Context, u *core.URL) error {
+	const q = `
+UPDATE urls SET long_url = $1, expires_at = $2, archived_at = $3, redirect_type = $4,
+                status = $5, status_reason = $6, status_changed_at = $7, starts_at = $8
+WHERE code = $9;`
+	res, err := s.db.ExecContext(ctx, q, u.LongURL, nullableTime(u.ExpiresAt), nullableTime(u.ArchivedAt), u.RedirectType,
+		u.LinkStatus(), u.StatusReason, nullableTime(u.StatusChangedAt), nullableTime(u.StartsAt), u.Code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes the record for code; its clicks go with it (ON DELETE CASCADE).
+func (s *Store) Delete(ctx context.Context, code string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM urls WHERE code = $1;`, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
+
+// List returns up to q.Limit records, newest (highest ID) first.
+func (s *Store) List(ctx context.Context, q core.ListQuery) ([]*core.URL, error) {
+	before := q.BeforeID
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	query := `SELECT ` + urlColumns + ` FROM urls
+WHERE id < $1 AND ($2::BIGINT = 0 OR owner_id = $2)
+ORDER BY id DESC LIMIT $3;`
+	rows, err := s.db.QueryContext(ctx, query, before, q.OwnerID, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*core.URL
+	for rows.Next() {
+		rec, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// IncrementHits increases the hits counter for code.
+// If the code doesn't exist, return ErrNotFound so the caller can log it.
+func (s *Store) IncrementHits(ctx context.Context, code string) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE urls SET hits = hits + 1 WHERE code = $1;`, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
+
+// ConsumeHit counts one redirect against the link's max_hits. The cap is
+// checked in the UPDATE itself, so concurrent callers cannot exceed it.
+func (s *Store) ConsumeHit(ctx context.Context, code string) (bool, error) {
+	const q = `UPDATE urls SET used_hits = used_hits + 1 WHERE code = $1 AND (max_hits = 0 OR used_hits < max_hits);`
+	res, err := s.db.ExecContext(ctx, q, code)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// PurgeExpired deletes expired links and returns deleted row count.
+func (s *Store) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	const q = `DELETE FROM urls WHERE expires_at IS NOT NULL AND expires_at <= $1;`
+	res, err := s.db.ExecContext(ctx, q, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	affected, _ := res.RowsAffected()
+	return affected, nil
+}
+
+// ArchiveExpired marks expired links as archived (soft delete) and returns
+// the number of newly archived rows. Archived rows keep resolving as expired.
+func (s *Store) ArchiveExpired(ctx context.Context, cutoff, now time.Time) (int64, error) {
+	const q = `
+UPDATE urls SET archived_at = $1
+WHERE expires_at IS NOT NULL AND expires_at <= $2 AND archived_at IS NULL;`
+	res, err := s.db.ExecContext(ctx, q, now.UTC(), cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	affected, _ := res.RowsAffected()
+	return affected, nil
+}
+
+// RecordClicks inserts click events and bumps hits counters in one transaction.
+// Codes are updated in sorted order so concurrent replicas can't deadlock.
+func (s *Store) RecordClicks(ctx context.Context, evs []core.ClickEvent) error {
+	if len(evs) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	perCode := make(map[string]int64)
+	for _, ev := range evs {
+		perCode[ev.Code]++
+	}
+	codes := make([]string, 0, len(perCode))
+	for code := range perCode {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if _, err := tx.ExecContext(ctx, `UPDATE urls SET hits = hits + $1 WHERE code = $2;`, perCode[code], code); err != nil {
+			return err
+		}
+	}
+
+	// Skip events whose code was deleted since the redirect (FK would fail the batch).
+	const q = `
+INSERT INTO clicks(code, at, referrer, user_agent, ip_hash, country)
+SELECT $1, $2, $3, $4, $5, $6
+WHERE EXISTS (SELECT 1 FROM urls WHERE code = $1);`
+	stmt, err := tx.PrepareContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, ev := range evs {
+		if _, err := stmt.ExecContext(ctx, ev.Code, ev.At.UTC().Unix(),
+			ev.Referrer, ev.UserAgent, ev.IPHash, ev.Country); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ClickStats aggregates clicks for code into buckets and top referrers.
+func (s *Store) ClickStats(ctx context.Context, code string, q core.StatsQuery) (*core.ClickStats, error) {
+	width := int64(core.BucketDuration(q.Bucket) / time.Second)
+	if width <= 0 {
+		return nil, core.ErrInvalidStats
+	}
+	from, to := q.From.UTC().Unix(), q.To.UTC().Unix()
+
+	const seriesQ = `
+SELECT (at / $1) * $1 AS bucket, COUNT(*)
+FROM clicks
+WHERE code = $2 AND at >= $3 AND at < $4
+GROUP BY bucket
+ORDER BY bucket;`
+	rows, err := s.db.QueryContext(ctx, seriesQ, width, code, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	st := &core.ClickStats{}
+	for rows.Next() {
+		var start, n int64
+		if err := rows.Scan(&start, &n); err != nil {
+			return nil, err
+		}
+		st.Series = append(st.Series, core.BucketCount{Start: time.Unix(start, 0).UTC(), Count: n})
+		st.Total += n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	const refQ = `
+SELECT referrer, COUNT(*) AS n
+FROM clicks
+WHERE code = $1 AND at >= $2 AND at < $3
+GROUP BY referrer
+ORDER BY n DESC, referrer
+LIMIT $4;`
+	refs, err := s.db.QueryContext(ctx, refQ, code, from, to, q.TopN)
+	if err != nil {
+		return nil, err
+	}
+	defer refs.Close()
+	for refs.Next() {
+		var rc core.ReferrerCount
+		if err := refs.Scan(&rc.Referrer, &rc.Count); err != nil {
+			return nil, err
+		}
+		st.TopReferrers = append(st.TopReferrers, rc)
+	}
+	return st, refs.Err()
+}
+
+// Compile-time check: *Store implements core.Store and every optional capability.
+var _ core.FullStore = (*Store)(nil)
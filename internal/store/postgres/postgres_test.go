@@ -0,0 +1,39 @@
+package postgres_test
+
+import (
+	"os"
+	"testing"
+
+	"urlshorty/internal/core"
+	"urlshorty/internal/store/postgres"
+	"urlshorty/internal/store/storetest"
+)
+
+// openTestStore connects to POSTGRES_TEST_URL and empties the tables.
+// Tests are skipped when no server is configured.
+func openTestStore(t *testing.T) core.Store {
+	t.Helper()
+	dsn := os.Getenv("POSTGRES_TEST_URL")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_URL not set; skipping PostgreSQL tests")
+	}
+	st, err := postgres.Open(dsn)
+	if err != nil {
+		t.Fatalf("postgres.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+
+	db, err := postgres.OpenDB(dsn)
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`TRUNCATE clicks, urls, api_keys RESTART IDENTITY CASCADE;`); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	return st
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, openTestStore)
+}
@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"urlshorty/internal/core"
+)
+
+// CreateAPIKey inserts a key with its secret hash and sets k.ID.
+func (s *Store) CreateAPIKey(ctx context.Context, k *core.APIKey, hash string) error {
+	const q = `
+INSERT INTO api_keys(name, key_hash, admin, created_at)
+VALUES (?, ?, ?, ?);`
+	res, err := s.db.ExecContext(ctx, q, k.Name, hash, k.Admin, k.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	k.ID, err = res.LastInsertId()
+	return err
+}
+
+// FindAPIKeyByHash returns the key whose secret hashes to hash (revoked included).
+func (s *Store) FindAPIKeyByHash(ctx context.Context, hash string) (*core.APIKey, error) {
+	const q = `
+SELECT id, name, admin, created_at, revoked_at
+FROM api_keys
+WHERE key_hash = ?
+LIMIT 1;`
+	k, err := scanAPIKey(s.db.QueryRowContext(ctx, q, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, core.ErrNotFound
+		}
+		return nil, err
+	}
+	return k, nil
+}
+
+// ListAPIKeys returns every key ordered by ID.
+func (s *Store) ListAPIKeys(ctx context.Context) ([]*core.APIKey, error) {
+	const q = `SELECT id, name, admin, created_at, revoked_at FROM api_keys ORDER BY id;`
+	rows, err := s.db.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*core.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// RevokeAPIKey sets revoked_at for id (keeping the first revocation time).
+func (s *Store) RevokeAPIKey(ctx context.Context, id int64, at time.Time) error {
+	const q = `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?;`
+	res, err := s.db.ExecContext(ctx, q, at.UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
+
+func scanAPIKey(row rowScanner) (*core.APIKey, error) {
+	var k core.APIKey
+	var created time.Time
+	var revoked sql.NullTime
+	if err := row.Scan(&k.ID, &k.Name, &k.Admin, &created, &revoked); err != nil {
+		return nil, err
+	}
+	k.CreatedAt = created.UTC()
+	if revoked.Valid {
+		t := revoked.Time.UTC()
+		k.RevokedAt = &t
+	}
+	return &k, nil
+}
+
+// Compile-time check: *Store implements core.KeyStore.
+var _ core.KeyStore = (*Store)(nil)
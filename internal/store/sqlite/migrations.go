@@ -1,25 +1,77 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"embed"
+
+	"urlshorty/internal/store/migrate"
 )
 
-// applyMigrations runs schema initialization for the SQLite database.
-// We keep it embedded (no external migration tool needed for the 1-day build).
-func applyMigrations(db *sql.DB) error {
-	_, err := db.Exec(schemaSQL)
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// NewMigrator returns the migration runner for the embedded SQLite schema.
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	return migrate.New(db, migrationFS, "migrations", migrate.Options{})
+}
+
+// applyMigrations brings the database schema up to date.
+// Databases created before migrations were tracked are adopted first.
+func applyMigrations(ctx context.Context, db *sql.DB) error {
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	if err := adoptLegacySchema(ctx, db, m); err != nil {
+		return err
+	}
+	_, err = m.Up(ctx)
 	return err
 }
 
-const schemaSQL = `
-CREATE TABLE IF NOT EXISTS urls (
-  id         INTEGER PRIMARY KEY AUTOINCREMENT,
-  code       TEXT    NOT NULL UNIQUE,
-  long_url   TEXT    NOT NULL,
-  created_at TIMESTAMP NOT NULL,
-  expires_at TIMESTAMP NULL,
-  hits       INTEGER NOT NULL DEFAULT 0
-);
-
-CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls(expires_at);
-`
+// adoptLegacySchema baselines databases created by builds that applied the
+// schema with CREATE TABLE IF NOT EXISTS and ad-hoc ALTERs, by detecting how
+// far their schema got. It is a no-op once schema_migrations exists.
+func adoptLegacySchema(ctx context.Context, db *sql.DB, m *migrate.Migrator) error {
+	tracked, err := tableExists(ctx, db, "schema_migrations")
+	if err != nil || tracked {
+		return err
+	}
+	// Each check corresponds to the migration with the same index + 1.
+	checks := []func() (bool, error){
+		func() (bool, error) { return tableExists(ctx, db, "urls") },
+		func() (bool, error) { return tableExists(ctx, db, "clicks") },
+		func() (bool, error) { return columnExists(ctx, db, "urls", "archived_at") },
+		func() (bool, error) { return columnExists(ctx, db, "urls", "owner_id") },
+	}
+	version := 0
+	for _, check := range checks {
+		ok, err := check()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		version++
+	}
+	if version == 0 {
+		return nil // fresh database
+	}
+	return m.Baseline(ctx, version)
+}
+
+func tableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?;`, table).Scan(&n)
+	return n > 0, err
+}
+
+func columnExists(ctx context.Context, db *sql.DB, table, column string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?;`, table, column).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_urls_expires_at;
+DROP TABLE IF EXISTS urls;
@@ -0,0 +1,12 @@
+-- One row per redirect. "at" is unix seconds (UTC) so buckets are plain integer math.
+CREATE TABLE clicks (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  code       TEXT    NOT NULL REFERENCES urls(code) ON DELETE CASCADE,
+  at         INTEGER NOT NULL,
+  referrer   TEXT    NOT NULL DEFAULT '',
+  user_agent TEXT    NOT NULL DEFAULT '',
+  ip_hash    TEXT    NOT NULL DEFAULT '',
+  country    TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_clicks_code_at ON clicks(code, at);
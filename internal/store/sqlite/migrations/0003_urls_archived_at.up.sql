@@ -0,0 +1,2 @@
+-- Soft delete for the expiry janitor (PURGE_MODE=archive).
+ALTER TABLE urls ADD COLUMN archived_at TIMESTAMP NULL;
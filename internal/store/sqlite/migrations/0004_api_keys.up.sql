@@ -0,0 +1,13 @@
+-- API keys; only a SHA-256 of the secret is stored.
+CREATE TABLE api_keys (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  name       TEXT      NOT NULL,
+  key_hash   TEXT      NOT NULL UNIQUE,
+  admin      INTEGER   NOT NULL DEFAULT 0,
+  created_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP NULL
+);
+
+ALTER TABLE urls ADD COLUMN owner_id INTEGER NULL REFERENCES api_keys(id);
+
+CREATE INDEX idx_urls_owner_id ON urls(owner_id);
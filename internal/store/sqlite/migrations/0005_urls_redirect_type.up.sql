@@ -0,0 +1,2 @@
+-- Per-link redirect status (301, 302, 307, 308); 0 = server default.
+ALTER TABLE urls ADD COLUMN redirect_type INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Scheduled links do not redirect before starts_at.
+ALTER TABLE urls ADD COLUMN starts_at TIMESTAMP NULL;
@@ -4,12 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"strings"
+	"math"
 	"time"
 
 	"urlshorty/internal/core"
 
-	_ "modernc.org/sqlite" // pure-Go SQLite driver (no CGO)
+	sqlitedriver "modernc.org/sqlite" // pure-Go SQLite driver (no CGO)
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 // Store implements core.Store backed by SQLite.
@@ -19,6 +20,20 @@ type Store struct {
 
 // Open opens (or creates) the SQLite DB at path and applies migrations.
 func Open(path string) (*Store, error) {
+	db, err := OpenDB(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyMigrations(context.Background(), db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// OpenDB opens the SQLite DB at path with the store's connection settings
+// but without applying migrations (see NewMigrator).
+func OpenDB(path string) (*sql.DB, error) {
 	// For modernc.org/sqlite, the DSN can be a simple file path.
 	db, err := sql.Open("sqlite", path)
 	if err != nil {
@@ -33,12 +48,7 @@ func Open(path string) (*Store, error) {
 	_, _ = db.Exec("PRAGMA busy_timeout = 5000;")
 	_, _ = db.Exec("PRAGMA journal_mode = WAL;")
 	_, _ = db.Exec("PRAGMA foreign_keys = ON;")
-
-	if err := applyMigrations(db); err != nil {
-		_ = db.Close()
-		return nil, err
-	}
-	return &Store{db: db}, nil
+	return db, nil
 }
 
 // Close releases the underlying DB.
@@ -47,57 +57,222 @@ func (s *Store) Close() error { return s.db.Close() }
 // Create inserts a new URL record. Returns core.ErrConflict if code already exists.
 func (s *Store) Create(ctx context.Context, u *core.URL) error {
 	const q = `
-INSERT INTO urls(code, long_url, created_at, expires_at, hits)
-VALUES (?, ?, ?, ?, 0);`
-	var exp interface{}
-	if u.ExpiresAt != nil {
-		exp = u.ExpiresAt.UTC()
-	} else {
-		exp = nil
-	}
-	_, err := s.db.ExecContext(ctx, q, u.Code, u.LongURL, u.CreatedAt.UTC(), exp)
-	if err != nil {
-		// Map unique violations to ErrConflict (driver-specific error codes vary,
-		// so we conservatively detect by message to keep deps minimal).
-		if strings.Contains(strings.ToLower(err.Error()), "unique constraint failed") ||
-			strings.Contains(strings.ToLower(err.Error()), "constraint failed") ||
-			strings.Contains(strings.ToLower(err.Error()), "unique") {
+INSERT INTO urls(code, long_url, created_at, expires_at, hits, owner_id, redirect_type,
+                 status, status_reason, status_changed_at, password_hash, max_hits, starts_at)
+VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?, ?, ?, ?, ?);`
+	res, err := s.db.ExecContext(ctx, q, u.Code, u.LongURL, u.CreatedAt.UTC(), nullableTime(u.ExpiresAt), nullableID(u.OwnerID), u.RedirectType,
+		u.LinkStatus(), u.StatusReason, nullableTime(u.StatusChangedAt), u.PasswordHash, u.MaxHits, nullableTime(u.StartsAt))
+	if err != nil {
+		// Only a taken code is a conflict; other constraint failures (e.g. an
+		// owner_id without an API key) are real errors.
+		if isUniqueViolation(err) {
 			return core.ErrConflict
 		}
 		return err
 	}
+	if id, err := res.LastInsertId(); err == nil {
+		u.ID = id
+	}
 	return nil
 }
 
-// FindByCode returns a URL record for the given code (expired included).
-func (s *Store) FindByCode(ctx context.Context, code string) (*core.URL, error) {
+// CreateBatch inserts recs in one transaction. Taken codes are skipped by
+// ON CONFLICT and reported as core.ErrConflict; with atomic set, the
+// transaction is rolled back if there are any.
+func (s *Store) CreateBatch(ctx context.Context, recs []*core.URL, atomic bool) ([]error, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
 	const q = `
-SELECT id, code, long_url, created_at, expires_at, hits
-FROM urls
-WHERE code = ?
-LIMIT 1;`
-	row := s.db.QueryRowContext(ctx, q, code)
+INSERT INTO urls(code, long_url, created_at, expires_at, hits, owner_id, redirect_type,
+                 status, status_reason, status_changed_at, password_hash, max_hits, starts_at)
+VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(code) DO NOTHING;`
+	stmt, err := tx.PrepareContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	errs := make([]error, len(recs))
+	failed := false
+	for i, u := range recs {
+		res, err := stmt.ExecContext(ctx, u.Code, u.LongURL, u.CreatedAt.UTC(), nullableTime(u.ExpiresAt), nullableID(u.OwnerID), u.RedirectType,
+			u.LinkStatus(), u.StatusReason, nullableTime(u.StatusChangedAt), u.PasswordHash, u.MaxHits, nullableTime(u.StartsAt))
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			errs[i], failed = core.ErrConflict, true
+			continue
+		}
+		if id, err := res.LastInsertId(); err == nil {
+			u.ID = id
+		}
+	}
+	if atomic && failed {
+		return errs, nil
+	}
+	return errs, tx.Commit()
+}
+
+// isUniqueViolation reports whether err is a SQLite UNIQUE or PRIMARY KEY
+// constraint failure.
+func isUniqueViolation(err error) bool {
+	var se *sqlitedriver.Error
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch se.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return true
+	}
+	return false
+}
+
+// urlColumns is the column list scanURL expects, in order.
+const urlColumns = `id, code, long_url, created_at, expires_at, hits, archived_at, owner_id, redirect_type,
+status, status_reason, status_changed_at, password_hash, max_hits, used_hits, starts_at`
 
+// rowScanner is satisfied by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanURL(row rowScanner) (*core.URL, error) {
 	var rec core.URL
 	var created time.Time
-	var expires sql.NullTime
+	var expires, archived, statusChanged, starts sql.NullTime
+	var owner sql.NullInt64
 
-	if err := row.Scan(&rec.ID, &rec.Code, &rec.LongURL, &created, &expires, &rec.Hits); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, core.ErrNotFound
-		}
+	if err := row.Scan(&rec.ID, &rec.Code, &rec.LongURL, &created, &expires, &rec.Hits, &archived, &owner, &rec.RedirectType,
+		&rec.Status, &rec.StatusReason, &statusChanged, &rec.PasswordHash, &rec.MaxHits, &rec.UsedHits, &starts); err != nil {
 		return nil, err
 	}
+	rec.OwnerID = owner.Int64
 	rec.CreatedAt = created.UTC()
 	if expires.Valid {
 		t := expires.Time.UTC()
 		rec.ExpiresAt = &t
-	} else {
-		rec.ExpiresAt = nil
+	}
+	if starts.Valid {
+		t := starts.Time.UTC()
+		rec.StartsAt = &t
+	}
+	if archived.Valid {
+		t := archived.Time.UTC()
+		rec.ArchivedAt = &t
+	}
+	if statusChanged.Valid {
+		t := statusChanged.Time.UTC()
+		rec.StatusChangedAt = &t
 	}
 	return &rec, nil
 }
 
+// nullableTime converts an optional time to a driver value (UTC or NULL).
+func nullableTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// nullableID maps the zero ID to NULL.
+func nullableID(id int64) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// FindByCode returns a URL record for the given code (expired included).
+func (s *Store) FindByCode(ctx context.Context, code string) (*core.URL, error) {
+	q := `SELECT ` + urlColumns + ` FROM urls WHERE code = ? LIMIT 1;`
+	rec, err := scanURL(s.db.QueryRowContext(ctx, q, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, core.ErrNotFound
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+// FindByLongURL returns the newest live link to q.LongURL for the owner and
+// redirect type in q, or core.ErrNotFound.
+func (s *Store) FindByLongURL(ctx context.Context, q core.LongURLQuery) (*core.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls
+WHERE long_url = ? AND owner_id IS ? AND redirect_type = ? AND status = 'active' AND password_hash = '' AND max_hits = 0
+  AND archived_at IS NULL AND (expires_at IS NULL OR expires_at > ?)
+ORDER BY id DESC LIMIT 1;`
+	rec, err := scanURL(s.db.QueryRowContext(ctx, query, q.LongURL, nullableID(q.OwnerID), q.RedirectType, q.Now.UTC()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, core.ErrNotFound
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Update overwrites the mutable fields of the record with u.Code.
+func (s *Store) Update(ctx context.Context, u *core.URL) error {
+	const q = `
+UPDATE urls SET long_url = ?, expires_at = ?, archived_at = ?, redirect_type = ?,
+                status = ?, status_reason = ?, status_changed_at = ?, starts_at = ?
+WHERE code = ?;`
+	res, err := s.db.ExecContext(ctx, q, u.LongURL, nullableTime(u.ExpiresAt), nullableTime(u.ArchivedAt), u.RedirectType,
+		u.LinkStatus(), u.StatusReason, nullableTime(u.StatusChangedAt), nullableTime(u.StartsAt), u.Code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes the record for code; its clicks go with it (ON DELETE CASCADE).
+func (s *Store) Delete(ctx context.Context, code string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM urls WHERE code = ?;`, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
+
+// List returns up to q.Limit records, newest (highest ID) first.
+func (s *Store) List(ctx context.Context, q core.ListQuery) ([]*core.URL, error) {
+	before := q.BeforeID
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	query := `SELECT ` + urlColumns + ` FROM urls
+WHERE id < ? AND (? = 0 OR owner_id = ?)
+ORDER BY id DESC LIMIT ?;`
+	rows, err := s.db.QueryContext(ctx, query, before, q.OwnerID, q.OwnerID, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*core.URL
+	for rows.Next() {
+		rec, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
 // IncrementHits increases the hits counter for code.
 // If the code doesn't exist, return ErrNotFound so the caller can log it.
 func (s *Store) IncrementHits(ctx context.Context, code string) error {
@@ -113,6 +288,18 @@ func (s *Store) IncrementHits(ctx context.Context, code string) error {
 	return nil
 }
 
+// ConsumeHit counts one redirect against the link's max_hits. The cap is
+// checked in the UPDATE itself, so concurrent callers cannot exceed it.
+func (s *Store) ConsumeHit(ctx context.Context, code string) (bool, error) {
+	const q = `UPDATE urls SET used_hits = used_hits + 1 WHERE code = ? AND (max_hits = 0 OR used_hits < max_hits);`
+	res, err := s.db.ExecContext(ctx, q, code)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
 // PurgeExpired deletes expired links and returns deleted row count.
 func (s *Store) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
 	const q = `
@@ -126,5 +313,115 @@ WHERE expires_at IS NOT NULL AND expires_at <= ?;`
 	return affected, nil
 }
 
-// Compile-time check: *Store implements core.Store.
-var _ core.Store = (*Store)(nil)
+// ArchiveExpired marks expired links as archived (soft delete) and returns
+// the number of newly archived rows. Archived rows keep resolving as expired.
+func (s *Store) ArchiveExpired(ctx context.Context, cutoff, now time.Time) (int64, error) {
+	const q = `
+UPDATE urls SET archived_at = ?
+WHERE expires_at IS NOT NULL AND expires_at <= ? AND archived_at IS NULL;`
+	res, err := s.db.ExecContext(ctx, q, now.UTC(), cutoff.UTC())
+	if err != nil {
+		return 0, err
+	}
+	affected, _ := res.RowsAffected()
+	return affected, nil
+}
+
+// RecordClicks inserts click events and bumps hits counters in one transaction.
+// Hits are aggregated per code so a batch costs one UPDATE per distinct code.
+func (s *Store) RecordClicks(ctx context.Context, evs []core.ClickEvent) error {
+	if len(evs) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	perCode := make(map[string]int64)
+	for _, ev := range evs {
+		perCode[ev.Code]++
+	}
+	for code, n := range perCode {
+		if _, err := tx.ExecContext(ctx, `UPDATE urls SET hits = hits + ? WHERE code = ?;`, n, code); err != nil {
+			return err
+		}
+	}
+
+	// Skip events whose code was deleted since the redirect (FK would fail the batch).
+	const q = `
+INSERT INTO clicks(code, at, referrer, user_agent, ip_hash, country)
+SELECT ?, ?, ?, ?, ?, ?
+WHERE EXISTS (SELECT 1 FROM urls WHERE code = ?);`
+	stmt, err := tx.PrepareContext(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, ev := range evs {
+		if _, err := stmt.ExecContext(ctx, ev.Code, ev.At.UTC().Unix(),
+			ev.Referrer, ev.UserAgent, ev.IPHash, ev.Country, ev.Code); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ClickStats aggregates clicks for code into buckets and top referrers.
+func (s *Store) ClickStats(ctx context.Context, code string, q core.StatsQuery) (*core.ClickStats, error) {
+	width := int64(core.BucketDuration(q.Bucket) / time.Second)
+	if width <= 0 {
+		return nil, core.ErrInvalidStats
+	}
+	from, to := q.From.UTC().Unix(), q.To.UTC().Unix()
+
+	const seriesQ = `
+SELECT (at / ?) * ? AS bucket, COUNT(*)
+FROM clicks
+WHERE code = ? AND at >= ? AND at < ?
+GROUP BY bucket
+ORDER BY bucket;`
+	rows, err := s.db.QueryContext(ctx, seriesQ, width, width, code, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	st := &core.ClickStats{}
+	for rows.Next() {
+		var start, n int64
+		if err := rows.Scan(&start, &n); err != nil {
+			return nil, err
+		}
+		st.Series = append(st.Series, core.BucketCount{Start: time.Unix(start, 0).UTC(), Count: n})
+		st.Total += n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	const refQ = `
+SELECT referrer, COUNT(*) AS n
+FROM clicks
+WHERE code = ? AND at >= ? AND at < ?
+GROUP BY referrer
+ORDER BY n DESC, referrer
+LIMIT ?;`
+	refs, err := s.db.QueryContext(ctx, refQ, code, from, to, q.TopN)
+	if err != nil {
+		return nil, err
+	}
+	defer refs.Close()
+	for refs.Next() {
+		var rc core.ReferrerCount
+		if err := refs.Scan(&rc.Referrer, &rc.Count); err != nil {
+			return nil, err
+		}
+		st.TopReferrers = append(st.TopReferrers, rc)
+	}
+	return st, refs.Err()
+}
+
+// Compile-time check: *Store implements core.Store and every optional capability.
+var _ core.FullStore = (*Store)(nil)
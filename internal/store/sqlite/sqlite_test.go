@@ -0,0 +1,39 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"urlshorty/internal/core"
+	"urlshorty/internal/store/sqlite"
+	"urlshorty/internal/store/storetest"
+)
+
+func open(t *testing.T, path string) core.Store {
+	t.Helper()
+	st, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("sqlite.Open: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	return st
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) core.Store {
+		return open(t, filepath.Join(t.TempDir(), "urlshorty.db"))
+	})
+}
+
+func TestConformance_InMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) core.Store { return open(t, ":memory:") })
+}
+
+func TestCreate_ForeignKeyIsNotAConflict(t *testing.T) {
+	st := open(t, ":memory:")
+	err := st.Create(context.Background(), &core.URL{Code: "orphan", LongURL: "https://e.example", OwnerID: 999})
+	if err == nil || core.IsConflict(err) {
+		t.Fatalf("owner without an API key: got %v, want a non-conflict error", err)
+	}
+}
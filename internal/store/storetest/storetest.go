@@ -0,0 +1,667 @@
+// Package storetest is a conformance suite for core.Store implementations.
+//
+// Backends call Run from their own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) core.Store { return openEmptyStore(t) })
+//	}
+//
+// The factory must return an empty store for every call; the suite registers
+// no cleanup of its own. Checks for the optional capabilities (core.ListStore,
+// core.StatsStore, core.DedupeStore, core.HitLimitStore, core.BatchStore, core.KeyStore) run only against stores
+// that implement them and are skipped otherwise.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"urlshorty/internal/core"
+)
+
+// Factory returns a new, empty store for one subtest.
+type Factory func(t *testing.T) core.Store
+
+// Run executes the whole conformance suite against stores built by newStore.
+func Run(t *testing.T, newStore Factory) {
+	t.Helper()
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, st core.Store)
+	}{
+		{"CreateAndFind", testCreateAndFind},
+		{"DuplicateCodeConflicts", testDuplicateCode},
+		{"NotFound", testNotFound},
+		{"ExpiredStillReturned", testExpiredStillReturned},
+		{"TimezoneRoundTrip", testTimezoneRoundTrip},
+		{"PurgeExpired", testPurgeExpired},
+		{"ArchiveExpired", testArchiveExpired},
+		{"UpdateAndDelete", testUpdateAndDelete},
+		{"ListPaging", testListPaging},
+		{"IncrementHits", testIncrementHits},
+		{"RecordClicksAndStats", testRecordClicksAndStats},
+		{"ConcurrentCreateSameCode", testConcurrentCreate},
+		{"ConcurrentHits", testConcurrentHits},
+		{"LongAndUnicodeValues", testLongAndUnicode},
+		{"APIKeys", testAPIKeys},
+		{"FindByLongURL", testFindByLongURL},
+		{"ConsumeHit", testConsumeHit},
+		{"CreateBatch", testCreateBatch},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newStore(t))
+		})
+	}
+}
+
+// ---- helpers ----
+
+// base is a fixed instant with sub-second precision every backend keeps
+// (PostgreSQL stores microseconds).
+var base = time.Date(2025, 3, 30, 1, 30, 15, 123456000, time.UTC)
+
+func ptr(t time.Time) *time.Time { return &t }
+
+func mustCreate(t *testing.T, st core.Store, u *core.URL) *core.URL {
+	t.Helper()
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = base
+	}
+	if err := st.Create(context.Background(), u); err != nil {
+		t.Fatalf("Create(%s): %v", u.Code, err)
+	}
+	return u
+}
+
+func mustFind(t *testing.T, st core.Store, code string) *core.URL {
+	t.Helper()
+	rec, err := st.FindByCode(context.Background(), code)
+	if err != nil {
+		t.Fatalf("FindByCode(%s): %v", code, err)
+	}
+	return rec
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// ---- cases ----
+
+func testCreateAndFind(t *testing.T, st core.Store) {
+	u := mustCreate(t, st, &core.URL{Code: "abc1234", LongURL: "https://example.com/a?b=c", StartsAt: ptr(base.Add(time.Minute)), ExpiresAt: ptr(base.Add(time.Hour)), RedirectType: 307})
+	if u.ID == 0 {
+		t.Fatal("Create did not set ID")
+	}
+	got := mustFind(t, st, "abc1234")
+	if got.ID != u.ID || got.LongURL != u.LongURL || got.Hits != 0 || got.RedirectType != 307 ||
+		got.Status != core.StatusActive || got.StatusChangedAt != nil {
+		t.Fatalf("round trip mismatch: got %+v want %+v", got, u)
+	}
+	if !got.CreatedAt.Equal(base) || !sameTime(got.StartsAt, u.StartsAt) || !sameTime(got.ExpiresAt, u.ExpiresAt) {
+		t.Fatalf("timestamps mismatch: got created=%v starts=%v expires=%v", got.CreatedAt, got.StartsAt, got.ExpiresAt)
+	}
+	if got.CreatedAt.Location() != time.UTC {
+		t.Fatalf("CreatedAt should be UTC, got %v", got.CreatedAt.Location())
+	}
+	locked := mustCreate(t, st, &core.URL{Code: "locked", LongURL: "https://example.com", PasswordHash: "$2a$10$hash"})
+	if got := mustFind(t, st, "locked"); got.PasswordHash != locked.PasswordHash || !got.Protected() {
+		t.Fatalf("password hash not stored: %+v", got)
+	}
+}
+
+func testDuplicateCode(t *testing.T, st core.Store) {
+	mustCreate(t, st, &core.URL{Code: "dup", LongURL: "https://a.example"})
+	err := st.Create(context.Background(), &core.URL{Code: "dup", LongURL: "https://b.example", CreatedAt: base})
+	if !errors.Is(err, core.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if got := mustFind(t, st, "dup"); got.LongURL != "https://a.example" {
+		t.Fatalf("conflicting Create overwrote the record: %+v", got)
+	}
+}
+
+func testNotFound(t *testing.T, st core.Store) {
+	ctx := context.Background()
+	if _, err := st.FindByCode(ctx, "nope"); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("FindByCode: expected ErrNotFound, got %v", err)
+	}
+	if err := st.IncrementHits(ctx, "nope"); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("IncrementHits: expected ErrNotFound, got %v", err)
+	}
+	if err := st.Update(ctx, &core.URL{Code: "nope", LongURL: "https://x.example"}); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("Update: expected ErrNotFound, got %v", err)
+	}
+	if err := st.Delete(ctx, "nope"); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("Delete: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testExpiredStillReturned(t *testing.T, st core.Store) {
+	mustCreate(t, st, &core.URL{Code: "old", LongURL: "https://example.com", ExpiresAt: ptr(time.Now().Add(-time.Hour).UTC())})
+	got := mustFind(t, st, "old")
+	if got.ExpiresAt == nil {
+		t.Fatal("expired record lost its ExpiresAt")
+	}
+}
+
+func testTimezoneRoundTrip(t *testing.T, st core.Store) {
+	// Non-UTC inputs, including one around a DST transition, must come back
+	// as the same instant.
+	berlin := time.FixedZone("CEST", 2*3600)
+	kolkata := time.FixedZone("IST", 5*3600+1800)
+	cases := map[string]time.Time{
+		"tz-berlin":  base.In(berlin),
+		"tz-kolkata": base.Add(48 * time.Hour).In(kolkata),
+		"tz-west":    base.In(time.FixedZone("PDT", -7*3600)),
+	}
+	for code, exp := range cases {
+		mustCreate(t, st, &core.URL{Code: code, LongURL: "https://example.com", CreatedAt: exp, ExpiresAt: ptr(exp)})
+		got := mustFind(t, st, code)
+		if !got.ExpiresAt.Equal(exp) || !got.CreatedAt.Equal(exp) {
+			t.Fatalf("%s: got expires=%v created=%v want %v", code, got.ExpiresAt, got.CreatedAt, exp)
+		}
+	}
+	// Comparisons against "now" must use the instant, not the wall clock.
+	n, err := st.PurgeExpired(context.Background(), base.Add(-time.Second))
+	if err != nil || n != 0 {
+		t.Fatalf("PurgeExpired before expiry: n=%d err=%v", n, err)
+	}
+	n, err = st.PurgeExpired(context.Background(), base.In(kolkata))
+	if err != nil || n != 2 {
+		t.Fatalf("PurgeExpired at expiry: n=%d err=%v (want the two records expiring at base)", n, err)
+	}
+}
+
+func testPurgeExpired(t *testing.T, st core.Store) {
+	ctx := context.Background()
+	mustCreate(t, st, &core.URL{Code: "p-past1", LongURL: "https://e.example", ExpiresAt: ptr(base.Add(-2 * time.Hour))})
+	mustCreate(t, st, &core.URL{Code: "p-past2", LongURL: "https://e.example", ExpiresAt: ptr(base.Add(-time.Minute))})
+	mustCreate(t, st, &core.URL{Code: "p-edge", LongURL: "https://e.example", ExpiresAt: ptr(base)})
+	mustCreate(t, st, &core.URL{Code: "p-future", LongURL: "https://e.example", ExpiresAt: ptr(base.Add(time.Second))})
+	mustCreate(t, st, &core.URL{Code: "p-never", LongURL: "https://e.example"})
+
+	n, err := st.PurgeExpired(ctx, base)
+	if err != nil || n != 3 {
+		t.Fatalf("PurgeExpired: n=%d err=%v (want 3: expiry <= now)", n, err)
+	}
+	for _, code := range []string{"p-past1", "p-past2", "p-edge"} {
+		if _, err := st.FindByCode(ctx, code); !errors.Is(err, core.ErrNotFound) {
+			t.Fatalf("%s should be purged, got %v", code, err)
+		}
+	}
+	mustFind(t, st, "p-future")
+	mustFind(t, st, "p-never")
+	if n, _ := st.PurgeExpired(ctx, base); n != 0 {
+		t.Fatalf("second PurgeExpired: expected 0, got %d", n)
+	}
+}
+
+func testArchiveExpired(t *testing.T, st core.Store) {
+	ctx := context.Background()
+	mustCreate(t, st, &core.URL{Code: "a-old", LongURL: "https://e.example", ExpiresAt: ptr(base.Add(-time.Hour))})
+	mustCreate(t, st, &core.URL{Code: "a-new", LongURL: "https://e.example", ExpiresAt: ptr(base.Add(time.Hour))})
+
+	now := base.Add(time.Minute)
+	n, err := st.ArchiveExpired(ctx, base, now)
+	if err != nil || n != 1 {
+		t.Fatalf("ArchiveExpired: n=%d err=%v", n, err)
+	}
+	got := mustFind(t, st, "a-old")
+	if got.ArchivedAt == nil || !got.ArchivedAt.Equal(now) {
+		t.Fatalf("ArchivedAt: got %v want %v", got.ArchivedAt, now)
+	}
+	if mustFind(t, st, "a-new").ArchivedAt != nil {
+		t.Fatal("unexpired record archived")
+	}
+	if n, _ := st.ArchiveExpired(ctx, base, now.Add(time.Hour)); n != 0 {
+		t.Fatalf("re-archiving: expected 0, got %d", n)
+	}
+}
+
+func testUpdateAndDelete(t *testing.T, st core.Store) {
+	ctx := context.Background()
+	u := mustCreate(t, st, &core.URL{Code: "upd", LongURL: "https://before.example", ExpiresAt: ptr(base)})
+
+	u.LongURL = "https://after.example"
+	u.ExpiresAt = nil
+	u.StartsAt = ptr(base.Add(time.Hour))
+	u.ArchivedAt = ptr(base)
+	u.RedirectType = 302
+	u.Status, u.StatusReason, u.StatusChangedAt = core.StatusQuarantined, "court order #12", ptr(base)
+	if err := st.Update(ctx, u); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got := mustFind(t, st, "upd")
+	if got.LongURL != "https://after.example" || got.ExpiresAt != nil || !sameTime(got.StartsAt, u.StartsAt) || !sameTime(got.ArchivedAt, u.ArchivedAt) ||
+		got.RedirectType != 302 || got.Status != core.StatusQuarantined || got.StatusReason != "court order #12" ||
+		!sameTime(got.StatusChangedAt, u.StatusChangedAt) {
+		t.Fatalf("Update not persisted: %+v", got)
+	}
+
+	if err := st.RecordClicks(ctx, []core.ClickEvent{{Code: "upd", At: base}}); err != nil {
+		t.Fatalf("RecordClicks: %v", err)
+	}
+	if err := st.Delete(ctx, "upd"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := st.FindByCode(ctx, "upd"); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("after Delete: expected ErrNotFound, got %v", err)
+	}
+	// A new link reusing the code starts without the old clicks.
+	mustCreate(t, st, &core.URL{Code: "upd", LongURL: "https://new.example"})
+	ss, ok := st.(core.StatsStore)
+	if !ok {
+		return
+	}
+	stats, err := ss.ClickStats(ctx, "upd", core.StatsQuery{
+		Bucket: core.BucketDay, From: base.Add(-48 * time.Hour), To: base.Add(48 * time.Hour), TopN: 10,
+	})
+	if err != nil || stats.Total != 0 {
+		t.Fatalf("clicks survived Delete: %+v err=%v", stats, err)
+	}
+}
+
+func testListPaging(t *testing.T, st core.Store) {
+	ls, ok := st.(core.ListStore)
+	if !ok {
+		t.Skip("store does not implement core.ListStore")
+	}
+	ctx := context.Background()
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		owner := int64(0)
+		if i%2 == 0 {
+			owner = ownerID(t, st)
+		}
+		u := mustCreate(t, st, &core.URL{Code: fmt.Sprintf("list-%d", i), LongURL: "https://e.example", OwnerID: owner})
+		ids = append(ids, u.ID)
+	}
+
+	page, err := ls.List(ctx, core.ListQuery{Limit: 2})
+	if err != nil || len(page) != 2 || page[0].Code != "list-4" || page[1].Code != "list-3" {
+		t.Fatalf("List first page: %v err=%v", codes(page), err)
+	}
+	page, err = ls.List(ctx, core.ListQuery{BeforeID: page[1].ID, Limit: 10})
+	if err != nil || len(page) != 3 || page[0].Code != "list-2" || page[2].Code != "list-0" {
+		t.Fatalf("List second page: %v err=%v", codes(page), err)
+	}
+
+	owned, err := ls.List(ctx, core.ListQuery{OwnerID: ownerID(t, st), Limit: 10})
+	if err != nil || len(owned) != 3 {
+		t.Fatalf("List by owner: %v err=%v", codes(owned), err)
+	}
+	for _, u := range owned {
+		if u.OwnerID != ownerID(t, st) {
+			t.Fatalf("List by owner returned %s owned by %d", u.Code, u.OwnerID)
+		}
+	}
+}
+
+func testIncrementHits(t *testing.T, st core.Store) {
+	mustCreate(t, st, &core.URL{Code: "hits", LongURL: "https://e.example"})
+	for i := 0; i < 3; i++ {
+		if err := st.IncrementHits(context.Background(), "hits"); err != nil {
+			t.Fatalf("IncrementHits: %v", err)
+		}
+	}
+	if got := mustFind(t, st, "hits"); got.Hits != 3 {
+		t.Fatalf("expected 3 hits, got %d", got.Hits)
+	}
+}
+
+func testRecordClicksAndStats(t *testing.T, st core.Store) {
+	ctx := context.Background()
+	mustCreate(t, st, &core.URL{Code: "clk", LongURL: "https://e.example"})
+	mustCreate(t, st, &core.URL{Code: "other", LongURL: "https://e.example"})
+
+	hour := base.Truncate(time.Hour)
+	evs := []core.ClickEvent{
+		{Code: "clk", At: hour.Add(1 * time.Minute), Referrer: "a.example"},
+		{Code: "clk", At: hour.Add(2 * time.Minute), Referrer: "a.example"},
+		{Code: "clk", At: hour.Add(61 * time.Minute), Referrer: "b.example", UserAgent: "ua", IPHash: "h"},
+		{Code: "clk", At: hour.Add(3 * time.Hour)}, // outside the window below
+		{Code: "other", At: hour},
+		{Code: "ghost", At: hour}, // unknown code: skipped, not an error
+	}
+	if err := st.RecordClicks(ctx, evs); err != nil {
+		t.Fatalf("RecordClicks: %v", err)
+	}
+	if err := st.RecordClicks(ctx, nil); err != nil {
+		t.Fatalf("RecordClicks(nil): %v", err)
+	}
+	if got := mustFind(t, st, "clk"); got.Hits != 4 {
+		t.Fatalf("expected 4 hits, got %d", got.Hits)
+	}
+
+	ss, ok := st.(core.StatsStore)
+	if !ok {
+		return
+	}
+	stats, err := ss.ClickStats(ctx, "clk", core.StatsQuery{
+		Bucket: core.BucketHour, From: hour, To: hour.Add(2 * time.Hour), TopN: 1,
+	})
+	if err != nil {
+		t.Fatalf("ClickStats: %v", err)
+	}
+	if stats.Total != 3 || len(stats.Series) != 2 {
+		t.Fatalf("ClickStats series: total=%d series=%+v", stats.Total, stats.Series)
+	}
+	if !stats.Series[0].Start.Equal(hour) || stats.Series[0].Count != 2 || stats.Series[1].Count != 1 {
+		t.Fatalf("ClickStats buckets: %+v", stats.Series)
+	}
+	if len(stats.TopReferrers) != 1 || stats.TopReferrers[0] != (core.ReferrerCount{Referrer: "a.example", Count: 2}) {
+		t.Fatalf("ClickStats referrers: %+v", stats.TopReferrers)
+	}
+}
+
+func testConcurrentCreate(t *testing.T, st core.Store) {
+	const n = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- st.Create(context.Background(), &core.URL{
+				Code: "race", LongURL: fmt.Sprintf("https://e.example/%d", i), CreatedAt: base,
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	ok := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case !errors.Is(err, core.ErrConflict):
+			t.Fatalf("concurrent Create: unexpected error %v", err)
+		}
+	}
+	if ok != 1 {
+		t.Fatalf("expected exactly one successful Create, got %d", ok)
+	}
+}
+
+func testConcurrentHits(t *testing.T, st core.Store) {
+	mustCreate(t, st, &core.URL{Code: "busy", LongURL: "https://e.example"})
+	const workers, each = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				if err := st.IncrementHits(context.Background(), "busy"); err != nil {
+					t.Errorf("IncrementHits: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		batch := make([]core.ClickEvent, each)
+		for i := range batch {
+			batch[i] = core.ClickEvent{Code: "busy", At: base}
+		}
+		if err := st.RecordClicks(context.Background(), batch); err != nil {
+			t.Errorf("RecordClicks: %v", err)
+		}
+	}()
+	wg.Wait()
+	if got := mustFind(t, st, "busy"); got.Hits != (workers+1)*each {
+		t.Fatalf("lost updates: expected %d hits, got %d", (workers+1)*each, got.Hits)
+	}
+}
+
+func testLongAndUnicode(t *testing.T, st core.Store) {
+	long := "https://example.com/" + strings.Repeat("x", 2048)
+	mustCreate(t, st, &core.URL{Code: "long", LongURL: long})
+	if got := mustFind(t, st, "long"); got.LongURL != long {
+		t.Fatalf("long URL truncated to %d bytes", len(got.LongURL))
+	}
+	uni := "https://例え.テスト/パス?q=ü&x='\";--"
+	mustCreate(t, st, &core.URL{Code: "uni", LongURL: uni})
+	if got := mustFind(t, st, "uni"); got.LongURL != uni {
+		t.Fatalf("unicode URL mangled: %q", got.LongURL)
+	}
+	// Codes are case-sensitive.
+	mustCreate(t, st, &core.URL{Code: "Case", LongURL: "https://upper.example"})
+	mustCreate(t, st, &core.URL{Code: "case", LongURL: "https://lower.example"})
+	if got := mustFind(t, st, "Case"); got.LongURL != "https://upper.example" {
+		t.Fatalf("codes must be case-sensitive, got %q", got.LongURL)
+	}
+}
+
+func testAPIKeys(t *testing.T, st core.Store) {
+	ks, ok := st.(core.KeyStore)
+	if !ok {
+		t.Skip("store does not implement core.KeyStore")
+	}
+	ctx := context.Background()
+	k := &core.APIKey{Name: "ci", Admin: true, CreatedAt: base}
+	if err := ks.CreateAPIKey(ctx, k, "hash-1"); err != nil || k.ID == 0 {
+		t.Fatalf("CreateAPIKey: id=%d err=%v", k.ID, err)
+	}
+	got, err := ks.FindAPIKeyByHash(ctx, "hash-1")
+	if err != nil || got.ID != k.ID || got.Name != "ci" || !got.Admin || got.RevokedAt != nil {
+		t.Fatalf("FindAPIKeyByHash: %+v err=%v", got, err)
+	}
+	if _, err := ks.FindAPIKeyByHash(ctx, "nope"); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("unknown hash: expected ErrNotFound, got %v", err)
+	}
+	if err := ks.RevokeAPIKey(ctx, k.ID, base.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	_ = ks.RevokeAPIKey(ctx, k.ID, base.Add(2*time.Hour)) // first revocation time wins
+	got, _ = ks.FindAPIKeyByHash(ctx, "hash-1")
+	if got.RevokedAt == nil || !got.RevokedAt.Equal(base.Add(time.Hour)) {
+		t.Fatalf("RevokedAt: %v", got.RevokedAt)
+	}
+	if err := ks.RevokeAPIKey(ctx, 9999, base); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("revoke unknown: expected ErrNotFound, got %v", err)
+	}
+	list, err := ks.ListAPIKeys(ctx)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListAPIKeys: %d err=%v", len(list), err)
+	}
+}
+
+func testFindByLongURL(t *testing.T, st core.Store) {
+	ds, ok := st.(core.DedupeStore)
+	if !ok {
+		t.Skip("store does not implement core.DedupeStore")
+	}
+	ctx := context.Background()
+	const dest = "https://dedupe.example/path"
+	owner := ownerID(t, st)
+	mustCreate(t, st, &core.URL{Code: "dd-old", LongURL: dest})
+	newest := mustCreate(t, st, &core.URL{Code: "dd-new", LongURL: dest})
+	mustCreate(t, st, &core.URL{Code: "dd-owned", LongURL: dest, OwnerID: owner})
+	mustCreate(t, st, &core.URL{Code: "dd-307", LongURL: dest, RedirectType: 307})
+	mustCreate(t, st, &core.URL{Code: "dd-expired", LongURL: dest, ExpiresAt: ptr(base)})
+
+	q := core.LongURLQuery{LongURL: dest, Now: base}
+	got, err := ds.FindByLongURL(ctx, q)
+	if err != nil || got.Code != newest.Code {
+		t.Fatalf("anonymous lookup: %+v err=%v", got, err)
+	}
+	q.OwnerID = owner
+	if got, err := ds.FindByLongURL(ctx, q); err != nil || got.Code != "dd-owned" {
+		t.Fatalf("owner lookup: %+v err=%v", got, err)
+	}
+	q.OwnerID, q.RedirectType = 0, 307
+	if got, err := ds.FindByLongURL(ctx, q); err != nil || got.Code != "dd-307" {
+		t.Fatalf("redirect type lookup: %+v err=%v", got, err)
+	}
+	q.LongURL, q.RedirectType = "https://dedupe.example/other", 0
+	if _, err := ds.FindByLongURL(ctx, q); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("unknown URL: expected ErrNotFound, got %v", err)
+	}
+
+	// Expired and archived links are never reused.
+	for _, code := range []string{"dd-old", "dd-new"} {
+		if err := st.Delete(ctx, code); err != nil {
+			t.Fatalf("Delete(%s): %v", code, err)
+		}
+	}
+	q.LongURL = dest
+	if _, err := ds.FindByLongURL(ctx, q); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("expired link reused: %v", err)
+	}
+	arch := mustCreate(t, st, &core.URL{Code: "dd-arch", LongURL: dest})
+	arch.ArchivedAt = ptr(base)
+	if err := st.Update(ctx, arch); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := ds.FindByLongURL(ctx, q); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("archived link reused: %v", err)
+	}
+
+	// Neither are links taken down by an admin.
+	off := mustCreate(t, st, &core.URL{Code: "dd-off", LongURL: dest})
+	off.Status = core.StatusDisabled
+	if err := st.Update(ctx, off); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := ds.FindByLongURL(ctx, q); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("disabled link reused: %v", err)
+	}
+
+	// Or password-protected and capped ones.
+	mustCreate(t, st, &core.URL{Code: "dd-locked", LongURL: dest, PasswordHash: "$2a$10$hash"})
+	mustCreate(t, st, &core.URL{Code: "dd-capped", LongURL: dest, MaxHits: 3})
+	if _, err := ds.FindByLongURL(ctx, q); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("protected or capped link reused: %v", err)
+	}
+}
+
+func testConsumeHit(t *testing.T, st core.Store) {
+	hs, ok := st.(core.HitLimitStore)
+	if !ok {
+		t.Skip("store does not implement core.HitLimitStore")
+	}
+	ctx := context.Background()
+	mustCreate(t, st, &core.URL{Code: "cap1", LongURL: "https://e.example", MaxHits: 1})
+	if ok, err := hs.ConsumeHit(ctx, "cap1"); err != nil || !ok {
+		t.Fatalf("first hit: ok=%v err=%v", ok, err)
+	}
+	if ok, err := hs.ConsumeHit(ctx, "cap1"); err != nil || ok {
+		t.Fatalf("hit past the cap: ok=%v err=%v", ok, err)
+	}
+	if got := mustFind(t, st, "cap1"); got.MaxHits != 1 || got.UsedHits != 1 || !got.Exhausted() {
+		t.Fatalf("after cap: %+v", got)
+	}
+	if ok, err := hs.ConsumeHit(ctx, "nope"); err != nil || ok {
+		t.Fatalf("unknown code: ok=%v err=%v", ok, err)
+	}
+
+	// Concurrent redirects never exceed the cap.
+	const limit, workers = 5, 16
+	mustCreate(t, st, &core.URL{Code: "cap5", LongURL: "https://e.example", MaxHits: limit})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := hs.ConsumeHit(ctx, "cap5")
+			if err != nil {
+				t.Errorf("concurrent ConsumeHit: %v", err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != limit {
+		t.Fatalf("expected %d granted hits, got %d", limit, granted)
+	}
+	if got := mustFind(t, st, "cap5"); got.UsedHits != limit {
+		t.Fatalf("UsedHits = %d, want %d", got.UsedHits, limit)
+	}
+}
+
+func testCreateBatch(t *testing.T, st core.Store) {
+	bs, ok := st.(core.BatchStore)
+	if !ok {
+		t.Skip("store does not implement core.BatchStore")
+	}
+	ctx := context.Background()
+	mustCreate(t, st, &core.URL{Code: "taken", LongURL: "https://e.example/taken", CreatedAt: base})
+	batch := func(codes ...string) []*core.URL {
+		var out []*core.URL
+		for _, c := range codes {
+			out = append(out, &core.URL{Code: c, LongURL: "https://e.example/" + c, CreatedAt: base, MaxHits: 3})
+		}
+		return out
+	}
+
+	// All-or-nothing: one taken code rolls the batch back.
+	errs, err := bs.CreateBatch(ctx, batch("a1", "taken", "a2"), true)
+	if err != nil || len(errs) != 3 || errs[0] != nil || !core.IsConflict(errs[1]) || errs[2] != nil {
+		t.Fatalf("atomic: errs=%v err=%v", errs, err)
+	}
+	for _, code := range []string{"a1", "a2"} {
+		if _, err := st.FindByCode(ctx, code); !core.IsNotFound(err) {
+			t.Fatalf("%s survived the rollback: %v", code, err)
+		}
+	}
+
+	// Partial: conflicts (also within the batch) are skipped, the rest kept.
+	recs := batch("p1", "taken", "p2", "p1")
+	errs, err = bs.CreateBatch(ctx, recs, false)
+	if err != nil || len(errs) != 4 || errs[0] != nil || !core.IsConflict(errs[1]) || errs[2] != nil || !core.IsConflict(errs[3]) {
+		t.Fatalf("partial: errs=%v err=%v", errs, err)
+	}
+	if got := mustFind(t, st, "p1"); got.ID != recs[0].ID || got.ID == 0 || got.LongURL != recs[0].LongURL || got.MaxHits != 3 {
+		t.Fatalf("created %+v, stored %+v", recs[0], got)
+	}
+	mustFind(t, st, "p2")
+	if got := mustFind(t, st, "taken"); got.LongURL != "https://e.example/taken" {
+		t.Fatalf("conflicting insert overwrote the existing link: %+v", got)
+	}
+}
+
+// ownerID returns the ID of a key usable as a link owner, creating it once.
+// Stores without a KeyStore accept any non-zero owner.
+func ownerID(t *testing.T, st core.Store) int64 {
+	t.Helper()
+	ks, ok := st.(core.KeyStore)
+	if !ok {
+		return 42
+	}
+	if k, err := ks.FindAPIKeyByHash(context.Background(), "owner-hash"); err == nil {
+		return k.ID
+	}
+	k := &core.APIKey{Name: "owner", CreatedAt: base}
+	if err := ks.CreateAPIKey(context.Background(), k, "owner-hash"); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	return k.ID
+}
+
+func codes(us []*core.URL) []string {
+	out := make([]string, 0, len(us))
+	for _, u := range us {
+		out = append(out, u.Code)
+	}
+	return out
+}
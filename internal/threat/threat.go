@@ -0,0 +1,278 @@
+// Package threat matches destinations against locally stored threat lists.
+//
+// The list file is a text rendering of a Safe Browsing style update: entries
+// are grouped under "[THREAT_TYPE]" headers and are either domains or SHA-256
+// hash prefixes of URL expressions. It is read from disk only, so matching
+// works fully offline; List.Reload swaps in a new version atomically.
+//
+//	# comments and blank lines are ignored
+//	[SOCIAL_ENGINEERING]
+//	domain phish.example              # the domain and all its subdomains
+//	prefix 5d4b4a1c                   # hex hash prefix, 4 to 32 bytes
+//	[MALWARE]
+//	raw 4 3q2+7wEjRWc=                # prefix size + base64 concatenated prefixes
+package threat
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	minPrefixLen = 4
+	maxPrefixLen = sha256.Size
+
+	defaultThreat = "UNSPECIFIED"
+)
+
+// Stats describes the list currently in use.
+type Stats struct {
+	Domains  int       `json:"domains"`
+	Prefixes int       `json:"prefixes"`
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// List is a threat list loaded from a file. It is safe for concurrent use;
+// Match never blocks on a reload.
+type List struct {
+	path string
+
+	mu      sync.Mutex // serializes reloads
+	modTime time.Time
+	size    int64
+
+	cur atomic.Pointer[snapshot]
+}
+
+// Open loads the list at path.
+func Open(path string) (*List, error) {
+	l := &List{path: path}
+	if _, err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload re-reads the file if its size or modification time changed since
+// the last load and reports whether a new version was installed. On error
+// the previous version stays in use.
+func (l *List) Reload() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fi, err := os.Stat(l.path)
+	if err != nil {
+		return false, fmt.Errorf("threat list: %w", err)
+	}
+	if l.cur.Load() != nil && fi.ModTime().Equal(l.modTime) && fi.Size() == l.size {
+		return false, nil
+	}
+	f, err := os.Open(l.path)
+	if err != nil {
+		return false, fmt.Errorf("threat list: %w", err)
+	}
+	defer f.Close()
+	snap, err := parse(f)
+	if err != nil {
+		return false, fmt.Errorf("threat list %s: %w", l.path, err)
+	}
+	snap.loadedAt = time.Now()
+	l.cur.Store(snap)
+	l.modTime, l.size = fi.ModTime(), fi.Size()
+	return true, nil
+}
+
+// Match reports the threat type of the first entry u matches.
+func (l *List) Match(u *url.URL) (threat string, ok bool) {
+	return l.cur.Load().match(u)
+}
+
+// Stats returns the size of the current list.
+func (l *List) Stats() Stats {
+	s := l.cur.Load()
+	return Stats{Domains: len(s.domains), Prefixes: s.prefixCount, LoadedAt: s.loadedAt}
+}
+
+// snapshot is one immutable version of the list.
+type snapshot struct {
+	domains     map[string]string         // host -> threat type
+	prefixes    map[int]map[string]string // prefix length -> raw prefix -> threat type
+	lengths     []int                     // keys of prefixes, ascending
+	prefixCount int
+	loadedAt    time.Time
+}
+
+func parse(r io.Reader) (*snapshot, error) {
+	s := &snapshot{domains: make(map[string]string), prefixes: make(map[int]map[string]string)}
+	threat := defaultThreat
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // raw lines can be long
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			threat = strings.ToUpper(strings.TrimSpace(line[1 : len(line)-1]))
+			if threat == "" {
+				return nil, fmt.Errorf("line %d: empty threat type", n)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if err := s.add(threat, fields); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for l := range s.prefixes {
+		s.lengths = append(s.lengths, l)
+	}
+	sort.Ints(s.lengths)
+	return s, nil
+}
+
+func (s *snapshot) add(threat string, fields []string) error {
+	switch {
+	case fields[0] == "domain" && len(fields) == 2:
+		host, err := canonicalHost(fields[1])
+		if err != nil {
+			return fmt.Errorf("invalid domain %q", fields[1])
+		}
+		s.domains[host] = threat
+	case fields[0] == "prefix" && len(fields) == 2:
+		p, err := hex.DecodeString(fields[1])
+		if err != nil || len(p) < minPrefixLen || len(p) > maxPrefixLen {
+			return fmt.Errorf("invalid prefix %q", fields[1])
+		}
+		s.addPrefix(threat, p)
+	case fields[0] == "raw" && len(fields) == 3:
+		size, err := strconv.Atoi(fields[1])
+		if err != nil || size < minPrefixLen || size > maxPrefixLen {
+			return fmt.Errorf("invalid prefix size %q", fields[1])
+		}
+		raw, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil || len(raw) == 0 || len(raw)%size != 0 {
+			return fmt.Errorf("raw hashes are not a multiple of %d bytes", size)
+		}
+		for i := 0; i < len(raw); i += size {
+			s.addPrefix(threat, raw[i:i+size])
+		}
+	default:
+		return fmt.Errorf("unknown entry %q", strings.Join(fields, " "))
+	}
+	return nil
+}
+
+func (s *snapshot) addPrefix(threat string, p []byte) {
+	m := s.prefixes[len(p)]
+	if m == nil {
+		m = make(map[string]string)
+		s.prefixes[len(p)] = m
+	}
+	if _, dup := m[string(p)]; !dup {
+		s.prefixCount++
+	}
+	m[string(p)] = threat
+}
+
+func (s *snapshot) match(u *url.URL) (string, bool) {
+	hosts := hostSuffixes(strings.ToLower(u.Hostname()))
+	for _, h := range hosts {
+		if t, ok := s.domains[h]; ok {
+			return t, true
+		}
+	}
+	if len(s.lengths) == 0 {
+		return "", false
+	}
+	paths := pathPrefixes(u)
+	for _, h := range hosts {
+		for _, p := range paths {
+			sum := sha256.Sum256([]byte(h + p))
+			for _, l := range s.lengths {
+				if t, ok := s.prefixes[l][string(sum[:l])]; ok {
+					return t, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// hostSuffixes returns the exact host followed by up to four suffixes formed
+// from its last five labels, dropping leading labels one at a time and never
+// the bare top-level domain. IP addresses only yield themselves.
+func hostSuffixes(host string) []string {
+	out := []string{host}
+	if net.ParseIP(host) != nil {
+		return out
+	}
+	labels := strings.Split(host, ".")
+	start := len(labels) - 5
+	if start < 1 {
+		start = 1
+	}
+	for i := start; i < len(labels)-1; i++ {
+		out = append(out, strings.Join(labels[i:], "."))
+	}
+	return out
+}
+
+// pathPrefixes returns the path with query, the path alone, and up to four
+// directory prefixes starting at "/", as in Safe Browsing URL expressions.
+func pathPrefixes(u *url.URL) []string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var out []string
+	add := func(p string) {
+		for _, q := range out {
+			if q == p {
+				return
+			}
+		}
+		out = append(out, p)
+	}
+	if u.RawQuery != "" {
+		add(path + "?" + u.RawQuery)
+	}
+	add(path)
+	dirs := strings.Split(strings.Trim(path, "/"), "/")
+	prefix := "/"
+	for i := 0; i < len(dirs) && i < 4; i++ {
+		add(prefix)
+		prefix += dirs[i] + "/"
+	}
+	return out
+}
+
+func canonicalHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil || ascii == "" {
+		return "", fmt.Errorf("invalid host %q", host)
+	}
+	return ascii, nil
+}
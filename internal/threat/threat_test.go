@@ -0,0 +1,141 @@
+package threat
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func prefixOf(expr string, n int) []byte {
+	sum := sha256.Sum256([]byte(expr))
+	return sum[:n]
+}
+
+func writeList(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write list: %v", err)
+	}
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse %q: %v", raw, err)
+	}
+	return u
+}
+
+func TestList_Match(t *testing.T) {
+	raw := append(prefixOf("evil.example/malware/", 4), prefixOf("203.0.113.9/x.exe", 4)...)
+	body := strings.Join([]string{
+		"# test list",
+		"domain untyped.example",
+		"[SOCIAL_ENGINEERING]",
+		"domain Phish.Example   # case-insensitive",
+		"prefix " + hex.EncodeToString(prefixOf("login.bank.example/secure/verify?id=1", 8)),
+		"[MALWARE]",
+		"raw 4 " + base64.StdEncoding.EncodeToString(raw),
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "threats.txt")
+	writeList(t, path, body)
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if st := l.Stats(); st.Domains != 2 || st.Prefixes != 3 || st.LoadedAt.IsZero() {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	cases := []struct {
+		url    string
+		threat string
+	}{
+		{"https://phish.example/", "SOCIAL_ENGINEERING"},
+		{"https://a.b.phish.example/x", "SOCIAL_ENGINEERING"},
+		{"https://untyped.example/", "UNSPECIFIED"},
+		{"https://login.bank.example/secure/verify?id=1", "SOCIAL_ENGINEERING"},
+		{"https://login.bank.example/secure/verify?id=2", ""},
+		{"https://www.evil.example/malware/dropper.bin?x=1", "MALWARE"}, // host suffix + directory prefix
+		{"https://evil.example/safe/", ""},
+		{"http://203.0.113.9/x.exe", "MALWARE"},
+		{"https://example.com/", ""},
+		{"https://notphish.example/", ""},
+	}
+	for _, tc := range cases {
+		threat, ok := l.Match(mustParse(t, tc.url))
+		if ok != (tc.threat != "") || threat != tc.threat {
+			t.Errorf("%s: got (%q, %v), want %q", tc.url, threat, ok, tc.threat)
+		}
+	}
+}
+
+func TestList_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "threats.txt")
+	writeList(t, path, "domain one.example\n")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if changed, err := l.Reload(); err != nil || changed {
+		t.Fatalf("unchanged file: changed=%v err=%v", changed, err)
+	}
+
+	writeList(t, path, "domain two.example\ndomain three.example\n")
+	if changed, err := l.Reload(); err != nil || !changed {
+		t.Fatalf("changed file: changed=%v err=%v", changed, err)
+	}
+	if _, ok := l.Match(mustParse(t, "https://one.example/")); ok {
+		t.Fatal("entry from the old list still matches")
+	}
+	if _, ok := l.Match(mustParse(t, "https://two.example/")); !ok {
+		t.Fatal("entry from the new list does not match")
+	}
+
+	// A broken file keeps the previous version.
+	writeList(t, path, "domain two.example\nbogus line here\n")
+	if _, err := l.Reload(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected parse error on line 2, got %v", err)
+	}
+	if _, ok := l.Match(mustParse(t, "https://three.example/")); !ok {
+		t.Fatal("failed reload dropped the previous list")
+	}
+}
+
+func TestParse_Rejects(t *testing.T) {
+	for _, body := range []string{
+		"prefix abc",                  // odd hex
+		"prefix 0102",                 // too short
+		"raw 4 AQID",                  // 3 bytes, not a multiple of 4
+		"raw 2 AQID",                  // size below minimum
+		"domain",                      // missing value
+		"[]",                          // empty threat type
+		"url https://phish.example/",  // unknown entry
+		"domain exa mple.example",     // extra field
+		"domain bad_host!.example\n#", // invalid host
+	} {
+		if _, err := parse(strings.NewReader(body)); err == nil {
+			t.Errorf("%q: expected error", body)
+		}
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	if got, want := hostSuffixes("a.b.c.d.e.f.g"), []string{"a.b.c.d.e.f.g", "c.d.e.f.g", "d.e.f.g", "e.f.g", "f.g"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hostSuffixes = %v, want %v", got, want)
+	}
+	if got, want := hostSuffixes("example.com"), []string{"example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hostSuffixes = %v, want %v", got, want)
+	}
+	u := mustParse(t, "http://a.b/1/2/3/4/5/6.html?x=y")
+	if got, want := pathPrefixes(u), []string{"/1/2/3/4/5/6.html?x=y", "/1/2/3/4/5/6.html", "/", "/1/", "/1/2/", "/1/2/3/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pathPrefixes = %v, want %v", got, want)
+	}
+}
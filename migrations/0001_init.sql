@@ -1,23 +0,0 @@
--- Create urls table
-CREATE TABLE IF NOT EXISTS urls (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    code VARCHAR(10) NOT NULL UNIQUE,
-    original_url TEXT NOT NULL,
-    click_count INTEGER DEFAULT 0,
-    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-);
-
--- Create indexes for better performance
-CREATE INDEX IF NOT EXISTS idx_urls_code ON urls(code);
-CREATE INDEX IF NOT EXISTS idx_urls_original_url ON urls(original_url);
-CREATE INDEX IF NOT EXISTS idx_urls_created_at ON urls(created_at);
-
--- Create trigger to automatically update updated_at timestamp
-CREATE TRIGGER IF NOT EXISTS update_urls_updated_at 
-    AFTER UPDATE ON urls
-    FOR EACH ROW
-BEGIN
-    UPDATE urls SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
-END;
-